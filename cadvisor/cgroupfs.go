@@ -0,0 +1,485 @@
+package cadvisor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+)
+
+// cgroupfsClockTicks is the USER_HZ cpuacct.stat counts cpu time in
+const cgroupfsClockTicks = 100
+
+// cgroupfsRoots are the cgroups of the kubelet below which pods are found,
+// with the cgroupfs and the systemd cgroup drivers
+var cgroupfsRoots = []string{"kubepods", "kubepods.slice"}
+
+// cgroupfsWalked are the controllers whose hierarchies are walked to find the
+// containers, in order of preference
+var cgroupfsWalked = []string{"cpuacct", "memory", "blkio"}
+
+// cgroupfsRuntimes are the prefixes container runtimes give the systemd
+// scopes of containers
+var cgroupfsRuntimes = []string{"docker-", "cri-containerd-", "crio-"}
+
+// errCgroupfsFs is why the cgroupfs source disables the filesystem family
+var errCgroupfsFs = errors.New("the filesystem usage of containers is not found in cgroups")
+
+// tcpStates are the connection states of /proc/net/tcp by their hex code
+var tcpStates = map[string]func(s *info.TcpStat) *uint64{
+	"01": func(s *info.TcpStat) *uint64 { return &s.Established },
+	"02": func(s *info.TcpStat) *uint64 { return &s.SynSent },
+	"03": func(s *info.TcpStat) *uint64 { return &s.SynRecv },
+	"04": func(s *info.TcpStat) *uint64 { return &s.FinWait1 },
+	"05": func(s *info.TcpStat) *uint64 { return &s.FinWait2 },
+	"06": func(s *info.TcpStat) *uint64 { return &s.TimeWait },
+	"07": func(s *info.TcpStat) *uint64 { return &s.Close },
+	"08": func(s *info.TcpStat) *uint64 { return &s.CloseWait },
+	"09": func(s *info.TcpStat) *uint64 { return &s.LastAck },
+	"0A": func(s *info.TcpStat) *uint64 { return &s.Listen },
+	"0B": func(s *info.TcpStat) *uint64 { return &s.Closing },
+}
+
+// cgroupfsCapabilities returns what the probe of host lets the cgroupfs
+// source read, which never finds the filesystem usage of containers. The
+// probe is shared with the cadvisor source and copied.
+func cgroupfsCapabilities(host hostPaths) *capabilities {
+	caps := &capabilities{failed: map[string]error{"cgroupfs": errCgroupfsFs}, disabled: map[string]string{"fs": "cgroupfs"}}
+	if probed := probeHost(host); probed != nil {
+		for check, err := range probed.failed {
+			caps.failed[check] = err
+		}
+		for family, check := range probed.disabled {
+			caps.disabled[family] = check
+		}
+	}
+	return caps
+}
+
+// cgroupfsSource reads the cgroup v1 controllers of the kubernetes containers
+// below the cgroup root of the host, without cAdvisor. Containers are named
+// after their cgroup and identified by the log links of the kubelet, their
+// network is read from procfs through one of their processes.
+type cgroupfsSource struct {
+	host hostPaths
+}
+
+func newCgroupfsSource(host hostPaths) (*cgroupfsSource, error) {
+	if err := host.validate(sourceCgroupfs); err != nil {
+		return nil, err
+	}
+	return &cgroupfsSource{host: host}, nil
+}
+
+// Start is a no-op, cgroups are read on every collection
+func (c *cgroupfsSource) Start() error {
+	return nil
+}
+
+// GetContainerInfoV2 returns a sample of every kubernetes container taken
+// now, the cgroups only hold the current values
+func (c *cgroupfsSource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	names, err := c.containers()
+	if err != nil {
+		return nil, err
+	}
+	identities := kubernetesIdentities(filepath.Join(c.host.rootfs, "var", "log", "containers"))
+	now := time.Now()
+	containers := make(map[string]info.ContainerInfo, len(names))
+	for _, name := range names {
+		if c.exited(name) {
+			continue
+		}
+		cont := c.container(name, now)
+		if identity, ok := identities[containerID(name)]; ok {
+			cont.Spec.Labels = map[string]string{
+				KubernetesPodNamespaceLabel:  identity[0],
+				KubernetesPodNameLabel:       identity[1],
+				KubernetesContainerNameLabel: identity[2],
+			}
+		}
+		containers[name] = cont
+	}
+	return containers, nil
+}
+
+// containers lists the cgroups of the containers of pods, found in the first
+// controller hierarchy that has kubelet cgroups
+func (c *cgroupfsSource) containers() ([]string, error) {
+	for _, controller := range cgroupfsWalked {
+		root := filepath.Join(c.host.cgroup, controller)
+		names := []string{}
+		for _, kubepods := range cgroupfsRoots {
+			err := filepath.Walk(filepath.Join(root, kubepods), func(path string, f os.FileInfo, err error) error {
+				if err != nil {
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if !f.IsDir() {
+					return nil
+				}
+				name := "/" + filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+				if containerID(name) != "" {
+					names = append(names, name)
+					return filepath.SkipDir
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to list the cgroups of %s: %v", controller, err)
+			}
+		}
+		if len(names) > 0 {
+			return names, nil
+		}
+	}
+	return nil, nil
+}
+
+// containerID returns the id of the container whose cgroup is name, empty
+// unless name is the cgroup of a container below the cgroup of a pod
+func containerID(name string) string {
+	elements := strings.Split(strings.Trim(name, "/"), "/")
+	if len(elements) < 2 || !isPodCgroup(elements[len(elements)-2]) {
+		return ""
+	}
+	id := strings.TrimSuffix(elements[len(elements)-1], ".scope")
+	for _, prefix := range cgroupfsRuntimes {
+		id = strings.TrimPrefix(id, prefix)
+	}
+	return id
+}
+
+// isPodCgroup reports whether a cgroup is the one of a pod, pod<uid> with
+// the cgroupfs driver or kubepods-<qos>-pod<uid>.slice with systemd
+func isPodCgroup(element string) bool {
+	if strings.HasSuffix(element, ".slice") {
+		return strings.Contains(element, "-pod")
+	}
+	return strings.HasPrefix(element, "pod")
+}
+
+// kubernetesIdentities maps the id of every container the kubelet knows to its
+// namespace, pod and container name, found in the names of the log links of
+// dir, <pod>_<namespace>_<container>-<id>.log
+func kubernetesIdentities(dir string) map[string][3]string {
+	identities := map[string][3]string{}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return identities
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".log")
+		dash := strings.LastIndex(name, "-")
+		if dash < 0 || name == f.Name() {
+			continue
+		}
+		parts := strings.SplitN(name[:dash], "_", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		identities[name[dash+1:]] = [3]string{parts[1], parts[0], parts[2]}
+	}
+	return identities
+}
+
+// path returns the path of a file of the cgroup name in controller
+func (c *cgroupfsSource) path(controller, name, file string) string {
+	return filepath.Join(c.host.cgroup, controller, filepath.FromSlash(name), file)
+}
+
+// exited reports whether the processes of the cgroup name are gone while
+// its cgroup lingers, which only the pids controller tells
+func (c *cgroupfsSource) exited(name string) bool {
+	current, err := readUint(c.path("pids", name, "pids.current"))
+	return err == nil && current == 0
+}
+
+// container reads the spec and stats of the cgroup name, the controllers
+// that cannot be read are left out
+func (c *cgroupfsSource) container(name string, now time.Time) info.ContainerInfo {
+	spec := info.ContainerSpec{}
+	stats := &info.ContainerStats{Timestamp: now}
+	if cpu, err := c.cpu(name); err == nil {
+		spec.HasCpu = true
+		stats.Cpu = cpu
+		spec.Cpu.Limit, _ = readUint(c.path("cpu", name, "cpu.shares"))
+		spec.Cpu.Period, _ = readUint(c.path("cpu", name, "cpu.cfs_period_us"))
+		if quota, err := readInt(c.path("cpu", name, "cpu.cfs_quota_us")); err == nil && quota > 0 {
+			spec.Cpu.Quota = uint64(quota)
+		}
+	}
+	if memory, err := c.memory(name); err == nil {
+		spec.HasMemory = true
+		stats.Memory = memory
+		spec.Memory.Limit, _ = readUint(c.path("memory", name, "memory.limit_in_bytes"))
+	}
+	if diskIo := c.diskIo(name); diskIo != nil {
+		spec.HasDiskIo = true
+		stats.DiskIo = diskIo
+	}
+	if network, err := c.network(name); err == nil {
+		spec.HasNetwork = true
+		stats.Network = network
+	}
+	return info.ContainerInfo{Spec: spec, Stats: []*info.ContainerStats{stats}}
+}
+
+// cpu reads the cpu time of the cgroup name from cpuacct, and its throttling from cpu
+func (c *cgroupfsSource) cpu(name string) (*v1.CpuStats, error) {
+	total, err := readUint(c.path("cpuacct", name, "cpuacct.usage"))
+	if err != nil {
+		return nil, err
+	}
+	cpu := &v1.CpuStats{Usage: v1.CpuUsage{Total: total}}
+	if stat, err := readKeyValues(c.path("cpuacct", name, "cpuacct.stat")); err == nil {
+		cpu.Usage.User = stat["user"] * uint64(time.Second) / cgroupfsClockTicks
+		cpu.Usage.System = stat["system"] * uint64(time.Second) / cgroupfsClockTicks
+	}
+	if stat, err := readKeyValues(c.path("cpu", name, "cpu.stat")); err == nil {
+		cpu.CFS = v1.CpuCFS{Periods: stat["nr_periods"], ThrottledPeriods: stat["nr_throttled"], ThrottledTime: stat["throttled_time"]}
+	}
+	return cpu, nil
+}
+
+// memory reads the memory usage of the cgroup name, its working set leaves
+// out the inactive page cache like cAdvisor does
+func (c *cgroupfsSource) memory(name string) (*v1.MemoryStats, error) {
+	usage, err := readUint(c.path("memory", name, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	memory := &v1.MemoryStats{Usage: usage}
+	memory.MaxUsage, _ = readUint(c.path("memory", name, "memory.max_usage_in_bytes"))
+	memory.Failcnt, _ = readUint(c.path("memory", name, "memory.failcnt"))
+	stat, err := readKeyValues(c.path("memory", name, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+	memory.Cache = stat["total_cache"]
+	memory.RSS = stat["total_rss"]
+	memory.Swap = stat["total_swap"]
+	memory.MappedFile = stat["total_mapped_file"]
+	memory.ContainerData = v1.MemoryStatsMemoryData{Pgfault: stat["pgfault"], Pgmajfault: stat["pgmajfault"]}
+	memory.HierarchicalData = v1.MemoryStatsMemoryData{Pgfault: stat["total_pgfault"], Pgmajfault: stat["total_pgmajfault"]}
+	if inactive := stat["total_inactive_file"]; inactive < usage {
+		memory.WorkingSet = usage - inactive
+	} else {
+		memory.WorkingSet = 0
+	}
+	return memory, nil
+}
+
+// diskIo reads the blkio stats of the cgroup name, the bytes and requests
+// serviced fall back to the throttling stats without the CFQ scheduler.
+// It is nil when the cgroup has no blkio stats.
+func (c *cgroupfsSource) diskIo(name string) *v1.DiskIoStats {
+	read := func(files ...string) []v1.PerDiskStats {
+		for _, file := range files {
+			if stats := readBlkio(c.path("blkio", name, file)); len(stats) > 0 {
+				return stats
+			}
+		}
+		return nil
+	}
+	diskIo := &v1.DiskIoStats{
+		IoServiceBytes: read("blkio.io_service_bytes_recursive", "blkio.throttle.io_service_bytes"),
+		IoServiced:     read("blkio.io_serviced_recursive", "blkio.throttle.io_serviced"),
+		IoQueued:       read("blkio.io_queued_recursive"),
+		Sectors:        read("blkio.sectors_recursive"),
+		IoServiceTime:  read("blkio.io_service_time_recursive"),
+		IoWaitTime:     read("blkio.io_wait_time_recursive"),
+		IoMerged:       read("blkio.io_merged_recursive"),
+		IoTime:         read("blkio.time_recursive"),
+	}
+	if diskIo.IoServiceBytes == nil && diskIo.IoServiced == nil {
+		return nil
+	}
+	return diskIo
+}
+
+// network reads the interfaces and connections of the network namespace of
+// the cgroup name through its first process
+func (c *cgroupfsSource) network(name string) (*info.NetworkStats, error) {
+	pid, err := c.pid(name)
+	if err != nil {
+		return nil, err
+	}
+	proc := filepath.Join(c.host.procfs, pid, "net")
+	interfaces, err := readNetDev(filepath.Join(proc, "dev"))
+	if err != nil {
+		return nil, err
+	}
+	network := &info.NetworkStats{Interfaces: interfaces}
+	network.Tcp, _ = readTcpStates(filepath.Join(proc, "tcp"))
+	network.Tcp6, _ = readTcpStates(filepath.Join(proc, "tcp6"))
+	return network, nil
+}
+
+// pid returns a process of the cgroup name
+func (c *cgroupfsSource) pid(name string) (string, error) {
+	for _, controller := range cgroupfsWalked {
+		procs, err := ioutil.ReadFile(c.path(controller, name, "cgroup.procs"))
+		if err != nil {
+			continue
+		}
+		if fields := strings.Fields(string(procs)); len(fields) > 0 {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no process found in cgroup %s", name)
+}
+
+// readUint reads a file holding a single unsigned integer
+func readUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readInt reads a file holding a single integer, which may be negative
+func readInt(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readKeyValues reads a file of "<key> <value>" lines, lines that do not
+// parse are skipped
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+// readBlkio reads a blkio stats file of "<major>:<minor> <operation> <value>"
+// lines, or "<major>:<minor> <value>" lines counted as "Count", in the order
+// the devices are listed
+func readBlkio(path string) []v1.PerDiskStats {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var stats []v1.PerDiskStats
+	index := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || len(fields) > 3 {
+			continue
+		}
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			// the Total line of all devices
+			continue
+		}
+		op := "Count"
+		if len(fields) == 3 {
+			op = fields[1]
+		}
+		v, err := strconv.ParseUint(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		i, ok := index[fields[0]]
+		if !ok {
+			i = len(stats)
+			index[fields[0]] = i
+			stats = append(stats, v1.PerDiskStats{Major: major, Minor: minor, Stats: map[string]uint64{}})
+		}
+		stats[i].Stats[op] = v
+	}
+	return stats
+}
+
+// readNetDev reads the interface counters of /proc/<pid>/net/dev, leaving
+// out the loopback and the host side of container interfaces like cAdvisor
+func readNetDev(path string) ([]v1.InterfaceStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	interfaces := []v1.InterfaceStats{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.SplitN(scanner.Text(), ":", 2)
+		if len(line) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(line[0])
+		if name == "lo" || strings.HasPrefix(name, "veth") || strings.HasPrefix(name, "docker") {
+			continue
+		}
+		fields := strings.Fields(line[1])
+		if len(fields) != 16 {
+			continue
+		}
+		values := make([]uint64, len(fields))
+		for i, field := range fields {
+			values[i], _ = strconv.ParseUint(field, 10, 64)
+		}
+		interfaces = append(interfaces, v1.InterfaceStats{
+			Name:      name,
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDropped: values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDropped: values[11],
+		})
+	}
+	return interfaces, scanner.Err()
+}
+
+// readTcpStates counts the connections of /proc/<pid>/net/tcp or tcp6 by state
+func readTcpStates(path string) (info.TcpStat, error) {
+	stats := info.TcpStat{}
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if state, ok := tcpStates[fields[3]]; ok {
+			*state(&stats)++
+		}
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,194 @@
+package cadvisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	// nginxCgroup is a burstable container of the cgroupfs driver
+	nginxCgroup = "/kubepods/burstable/pod1f2e3d4c/3c6a1f2e"
+	// workerCgroup is a besteffort container of the systemd driver
+	workerCgroup = "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod5b6a7c8d.slice/docker-9e8d7c6b.scope"
+)
+
+// fakeCgroupfs writes a cgroup tree of a node below a fake rootfs: the nginx
+// and worker containers, a pause container the kubelet has no logs of, and an
+// exited container whose cgroup lingers
+func fakeCgroupfs(t *testing.T) string {
+	root := fakeRootfs(t)
+	nginx := func(controller, file string) string {
+		return filepath.Join("sys/fs/cgroup", controller, nginxCgroup, file)
+	}
+	for file, content := range map[string]string{
+		nginx("cpuacct", "cpuacct.usage"):                  "2000000000\n",
+		nginx("cpuacct", "cpuacct.stat"):                   "user 150\nsystem 50\n",
+		nginx("cpuacct", "cgroup.procs"):                   "42\n43\n",
+		nginx("cpu", "cpu.stat"):                           "nr_periods 10\nnr_throttled 2\nthrottled_time 3000\n",
+		nginx("cpu", "cpu.shares"):                         "256\n",
+		nginx("cpu", "cpu.cfs_quota_us"):                   "50000\n",
+		nginx("cpu", "cpu.cfs_period_us"):                  "100000\n",
+		nginx("memory", "memory.usage_in_bytes"):           "20971520\n",
+		nginx("memory", "memory.max_usage_in_bytes"):       "25165824\n",
+		nginx("memory", "memory.failcnt"):                  "3\n",
+		nginx("memory", "memory.limit_in_bytes"):           "134217728\n",
+		nginx("memory", "memory.stat"):                     "cache 4194304\ntotal_cache 4194304\ntotal_rss 8388608\ntotal_inactive_file 2097152\npgfault 10\npgmajfault 1\ntotal_pgfault 12\ntotal_pgmajfault 2\n",
+		nginx("blkio", "blkio.io_service_bytes_recursive"): "8:0 Read 4096\n8:0 Write 16384\n8:0 Sync 0\n8:0 Total 20480\nTotal 20480\n",
+		nginx("blkio", "blkio.io_serviced_recursive"):      "Total 0\n",
+		nginx("blkio", "blkio.throttle.io_serviced"):       "8:0 Read 1\n8:0 Write 4\n8:0 Total 5\nTotal 5\n",
+		nginx("blkio", "blkio.time_recursive"):             "8:0 1500\n",
+		nginx("pids", "pids.current"):                      "2\n",
+		"proc/42/net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0\n" +
+			"  eth0:    2000      20    1    0    0     0          0         0     4000      40    0    2    0     0       0          0\n",
+		"proc/42/net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0\n" +
+			"   1: 0100007F:0050 0100007F:A1B2 01 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 20 4 30 10 -1\n" +
+			"   2: 0100007F:0050 0100007F:A1B3 01 00000000:00000000 00:00000000 00000000     0        0 3 1 0000000000000000 20 4 30 10 -1\n",
+		filepath.Join("sys/fs/cgroup/cpuacct", workerCgroup, "cpuacct.usage"):         "1000\n",
+		"sys/fs/cgroup/cpuacct/kubepods/burstable/pod1f2e3d4c/a1b2c3d4/cpuacct.usage": "500\n",
+		"sys/fs/cgroup/cpuacct/kubepods/pod0a0b0c0d/7f7f7f7f/cpuacct.usage":           "5\n",
+		"sys/fs/cgroup/pids/kubepods/pod0a0b0c0d/7f7f7f7f/pids.current":               "0\n",
+		"sys/dev/block/8:0/uevent": "MAJOR=8\nMINOR=0\nDEVNAME=sda\nDEVTYPE=disk\n",
+		"var/log/containers/web-6d4cf56db6-x2x8k_default_nginx-3c6a1f2e.log": "",
+		"var/log/containers/job-abcde_batch_worker-9e8d7c6b.log":             "",
+		"var/log/containers/job-fghij_batch_done-7f7f7f7f.log":               "",
+	} {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestContainerID(t *testing.T) {
+	for name, expected := range map[string]string{
+		nginxCgroup:  "3c6a1f2e",
+		workerCgroup: "9e8d7c6b",
+		"/kubepods.slice/kubepods-pod1a2b.slice/cri-containerd-4d5e.scope":          "4d5e",
+		"/kubepods/burstable/pod1f2e3d4c":                                           "",
+		"/kubepods/burstable":                                                       "",
+		"/kubepods.slice/kubepods-burstable.slice":                                  "",
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b.slice": "",
+	} {
+		if id := containerID(name); id != expected {
+			t.Errorf("%s: expected id %q, got %q", name, expected, id)
+		}
+	}
+}
+
+func TestCgroupfsSource(t *testing.T) {
+	root := fakeCgroupfs(t)
+	defer os.RemoveAll(root)
+	source, err := newCgroupfsSource(hostPathsOf(plugin.Config{"rootfs": root}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Start(); err != nil {
+		t.Fatal(err)
+	}
+	containers, err := source.GetContainerInfoV2("/", info.RequestOptions{Count: 1, Recursive: true, IdType: info.TypeName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 3 {
+		t.Fatalf("expected nginx, worker and the pause container without the exited one, got %d", len(containers))
+	}
+	if pause := containers["/kubepods/burstable/pod1f2e3d4c/a1b2c3d4"]; pause.Spec.Labels != nil {
+		t.Errorf("expected no labels for a container without logs, got %v", pause.Spec.Labels)
+	}
+
+	nginx := containers[nginxCgroup]
+	if l := nginx.Spec.Labels; l[KubernetesPodNamespaceLabel] != "default" || l[KubernetesPodNameLabel] != "web-6d4cf56db6-x2x8k" || l[KubernetesContainerNameLabel] != "nginx" {
+		t.Errorf("unexpected nginx labels %v", l)
+	}
+	if s := nginx.Spec; s.Cpu.Limit != 256 || s.Cpu.Quota != 50000 || s.Cpu.Period != 100000 || s.Memory.Limit != 134217728 {
+		t.Errorf("unexpected nginx spec %+v", s)
+	}
+	s := nginx.Stats[0]
+	if u := s.Cpu.Usage; u.Total != 2e9 || u.User != 15e8 || u.System != 5e8 {
+		t.Errorf("unexpected cpu usage %+v", u)
+	}
+	if s.Cpu.CFS.ThrottledPeriods != 2 || s.Cpu.CFS.ThrottledTime != 3000 {
+		t.Errorf("unexpected cpu throttling %+v", s.Cpu.CFS)
+	}
+	if m := s.Memory; m.Usage != 20971520 || m.WorkingSet != 20971520-2097152 || m.Cache != 4194304 || m.Failcnt != 3 || m.ContainerData.Pgfault != 10 || m.HierarchicalData.Pgmajfault != 2 {
+		t.Errorf("unexpected memory stats %+v", m)
+	}
+	if d := s.DiskIo; len(d.IoServiceBytes) != 1 || d.IoServiceBytes[0].Stats["Write"] != 16384 || d.IoServiceBytes[0].Minor != 0 || d.IoTime[0].Stats["Count"] != 1500 {
+		t.Errorf("unexpected diskio stats %+v", d)
+	}
+	if d := s.DiskIo; d.IoServiced[0].Stats["Write"] != 4 {
+		t.Errorf("expected the serviced requests of the throttling stats, got %+v", d.IoServiced)
+	}
+	if n := s.Network; len(n.Interfaces) != 1 || n.Interfaces[0].Name != "eth0" || n.Interfaces[0].TxBytes != 4000 || n.Interfaces[0].TxDropped != 2 {
+		t.Errorf("expected the eth0 interface of the first process, got %+v", n)
+	}
+	if n := s.Network; n.Tcp.Established != 2 || n.Tcp.Listen != 1 || n.Tcp6 != (info.TcpStat{}) {
+		t.Errorf("unexpected tcp connections %+v %+v", n.Tcp, n.Tcp6)
+	}
+
+	// the worker only has a cpuacct cgroup
+	worker := containers[workerCgroup]
+	if worker.Spec.Labels[KubernetesContainerNameLabel] != "worker" || !worker.Spec.HasCpu || worker.Spec.HasMemory || worker.Spec.HasDiskIo || worker.Spec.HasNetwork {
+		t.Errorf("unexpected worker spec %+v", worker.Spec)
+	}
+
+	if _, err := newCgroupfsSource(hostPathsOf(plugin.Config{"rootfs": filepath.Join(root, "nonexistent")})); err == nil {
+		t.Error("expected an error for a missing rootfs")
+	}
+}
+
+func TestCgroupfsSourceCollected(t *testing.T) {
+	root := fakeCgroupfs(t)
+	defer os.RemoveAll(root)
+
+	cfg := plugin.Config{"interval": int64(15), "source": sourceCgroupfs, "rootfs": root, "prune_catalog": true}
+	c := NewCollector()
+	catalog, err := c.GetMetricTypes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range catalog {
+		if met, ok := lookupMetric(m.Namespace); ok && met.Family == "fs" {
+			t.Errorf("%s is not found in cgroups and should not be advertised", m.Namespace.String())
+		}
+	}
+	config := newSnapshot(requestAll(cfg))
+	if err := c.ensureSource(config); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{}
+	for _, m := range c.collect(config) {
+		values[m.Namespace.String()] = m.Data
+	}
+	prefix := "/" + PluginVendor + "/" + PluginName + "/container/"
+	for name, expected := range map[string]interface{}{
+		"default/web-6d4cf56db6-x2x8k/nginx/cpu/total/usage":        uint64(2e9),
+		"default/web-6d4cf56db6-x2x8k/nginx/mem/working_set":        uint64(20971520 - 2097152),
+		"default/web-6d4cf56db6-x2x8k/nginx/diskio/sda/write_bytes": uint64(16384),
+		"default/web-6d4cf56db6-x2x8k/nginx/iface/eth0/in_bytes":    uint64(2000),
+		"default/web-6d4cf56db6-x2x8k/nginx/tcp/ESTABLISHED":        uint64(2),
+		"batch/job-abcde/worker/cpu/total/usage":                    uint64(1000),
+	} {
+		if values[prefix+name] != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, values[prefix+name])
+		}
+	}
+	for name := range values {
+		if strings.Contains(name, "/fs/") || strings.Contains(name, "/done/") {
+			t.Errorf("unexpected metric %s", name)
+		}
+	}
+}
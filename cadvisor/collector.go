@@ -3,9 +3,12 @@ package cadvisor
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
@@ -13,7 +16,6 @@ import (
 	"github.com/google/cadvisor/container"
 	info "github.com/google/cadvisor/info/v2"
 	"github.com/google/cadvisor/manager"
-	"github.com/google/cadvisor/utils/sysfs"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 )
@@ -34,6 +36,7 @@ const (
 )
 
 var (
+	defaultInterval             = 15 * time.Second                                                  // Interval between emissions until a task sets one
 	storageDuration             = 1 * time.Minute                                                   // How long to keep data stored
 	defaultHousekeepingInterval = 10 * time.Second                                                  // Interval for cadvisor to perform housekeeping, effects cpu usage
 	maxHousekeepingInterval     = 60 * time.Second                                                  // Largest interval to allow between container housekeepings
@@ -44,10 +47,20 @@ var (
 
 // Collector contains the components to collect cadvisor metrics
 type Collector struct {
-	mng      manager.Manager
-	manifest Manifest
-	lock     *sync.Mutex
-	interval time.Duration
+	mng         containerSource
+	sourceLock  *sync.Mutex
+	sourceTried *snapshot
+	sourceErr   error
+	history     time.Duration
+	config      *atomic.Value
+	updated     chan struct{}
+	stats       *selfStats
+	samples     *sampleTracker
+	series      *seriesCache
+	exporter    *exporter
+	polling     *poller
+	tags        *globalTags
+	listing     *lister
 }
 
 func init() {
@@ -70,13 +83,86 @@ func init() {
 }
 
 // buildOrganizer waits on updates from the active task manifest on which metrics to collect
-func (c *Collector) buildOrganizer(in chan []plugin.Metric) {
+func (c *Collector) buildOrganizer(ctx context.Context, in chan []plugin.Metric) {
 	for {
-		newMetrics := <-in
-		c.lock.Lock()
-		c.interval = c.manifest.buildMetricsList(newMetrics)
-		c.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case newMetrics := <-in:
+			c.config.Store(newSnapshot(newMetrics))
+			c.samples.reset()
+			select {
+			case c.updated <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// newManager creates the embedded cAdvisor container manager reading the
+// devices of host and its container runtimes, keeping the samples of history.
+// host must exist and its paths must be ones cAdvisor can be pointed to.
+func newManager(host hostPaths, history time.Duration) (containerSource, error) {
+	if err := host.validate(sourceCadvisor); err != nil {
+		return nil, err
+	}
+	host.configureRuntimes()
+	return manager.New(memory.New(history, nil), newHostSysFs(host.sysfs), maxHousekeepingInterval, allowDynamicHousekeeping, ignoreMetrics, http.DefaultClient)
+}
+
+// ensureSource creates and starts the container source selected by config once
+// a task configured the collector. The source is kept for the lifetime of the
+// plugin, a source that failed to start is retried with the next task config.
+func (c *Collector) ensureSource(config *snapshot) error {
+	c.sourceLock.Lock()
+	defer c.sourceLock.Unlock()
+	if c.mng != nil || !config.configured {
+		return nil
+	}
+	if c.sourceTried == config {
+		return c.sourceErr
+	}
+	c.sourceTried = config
+	source, err := newSource(config)
+	if err != nil {
+		c.sourceErr = fmt.Errorf("failed to create %s container source: %v", config.source, err)
+		return c.sourceErr
+	}
+	if err := source.Start(); err != nil {
+		c.sourceErr = fmt.Errorf("failed to start %s container source: %v", config.source, err)
+		return c.sourceErr
+	}
+	c.mng = source
+	c.sourceErr = nil
+	if config.source == sourceCadvisor {
+		c.history = config.history()
+	}
+	return nil
+}
+
+// checkHistory reports a config whose summaries or high resolution need more
+// samples than the source keeps. The history of the embedded cAdvisor is set
+// by the task that started it and cannot grow with the interval of later ones.
+func (c *Collector) checkHistory(config *snapshot) error {
+	c.sourceLock.Lock()
+	history := c.history
+	c.sourceLock.Unlock()
+	if history == 0 || config.history() <= history {
+		return nil
 	}
+	return fmt.Errorf("cAdvisor keeps %v of samples, summaries and high resolution only cover that part of the %v interval", history, config.interval)
+}
+
+// source returns the started container source, nil until a task configured it
+func (c *Collector) source() containerSource {
+	c.sourceLock.Lock()
+	defer c.sourceLock.Unlock()
+	return c.mng
+}
+
+// current returns the task configuration to use for the next collection
+func (c *Collector) current() *snapshot {
+	return c.config.Load().(*snapshot)
 }
 
 // StreamMetrics takes both an in and out channel of []plugin.Metric
@@ -87,214 +173,219 @@ func (c *Collector) buildOrganizer(in chan []plugin.Metric) {
 // The mtxOut channel is used by the plugin to send the collected metrics
 // to Snap.
 func (c *Collector) StreamMetrics(ctx context.Context, mtxIn chan []plugin.Metric, mtxOut chan []plugin.Metric, chanErr chan string) error {
-	go c.buildOrganizer(mtxIn)
-	var contInfo [3]string
-	var ok bool
-	var err error
-	c.mng, err = manager.New(memory.New(storageDuration, nil), sysfs.NewRealSysFs(), maxHousekeepingInterval, allowDynamicHousekeeping, ignoreMetrics, http.DefaultClient)
-	if err != nil {
-		log.Fatalf("Failed to create a Container Manager: %v", err)
-		chanErr <- err.Error()
-	}
-	// Start the manager.
-	if err := c.mng.Start(); err != nil {
-		log.Fatalf("Failed to start container manager: %v", err)
-		chanErr <- err.Error()
-	}
-
+	go c.buildOrganizer(ctx, mtxIn)
+	defer c.exporter.close()
+	// failed is the config the source last failed to start with, invalid the
+	// last one with invalid device filters, truncated the last one needing more
+	// samples than the source keeps and limited the last one that hit the
+	// series limits, each is reported once
+	var failed, invalid, truncated, limited *snapshot
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var planned time.Time
 	for {
-		c.lock.Lock()
-		containers, err := c.mng.GetContainerInfoV2("/", info.RequestOptions{Count: 1, Recursive: true, IdType: info.TypeName})
-		if err != nil {
-			log.Printf("unable to gather container metrics: %v", err)
-		}
-		metrics := []plugin.Metric{}
-		for _, cont := range containers {
-			if len(cont.Stats) < 1 {
-				log.Printf("no container stats currently available")
-				continue
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.updated:
+			// A new manifest applies right away instead of after the current interval,
+			// aligned schedules only move to the next boundary of the new interval
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
-			if contInfo, ok = checkContainer(cont.Spec.Labels); !ok {
+			if config := c.current(); config.aligned {
+				planned = time.Time{}
+				timer.Reset(c.nextDelay(config, &planned, time.Now()))
 				continue
 			}
-			if cont.Spec.HasNetwork {
-				for _, key := range c.manifest.tcpMetrics {
-					m, ok := tcpMap[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the tcp metric map\n", key)
-						continue
-					}
-					metrics = append(metrics, plugin.Metric{
-						Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2]),
-						Description: m.Description,
-						Unit:        m.Unit,
-						Data:        m.Data(cont.Stats[0]),
-						Timestamp:   cont.Stats[0].Timestamp,
-					})
-				}
-				for _, key := range c.manifest.tcp6Metrics {
-					m, ok := tcp6Map[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the tcp6 metric map\n", key)
-						continue
-					}
-					metrics = append(metrics, plugin.Metric{
-						Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2]),
-						Description: m.Description,
-						Unit:        m.Unit,
-						Data:        m.Data(cont.Stats[0]),
-						Timestamp:   cont.Stats[0].Timestamp,
-					})
-				}
-				for _, key := range c.manifest.ifaceMetrics {
-					m, ok := ifaceMap[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the iface metric map\n", key)
-						continue
-					}
-					for _, iface := range cont.Stats[0].Network.Interfaces {
-						metrics = append(metrics, plugin.Metric{
-							Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], iface.Name),
-							Description: m.Description,
-							Unit:        m.Unit,
-							Data:        m.Data(iface),
-							Timestamp:   cont.Stats[0].Timestamp,
-						})
-					}
-				}
-			}
+		case <-timer.C:
+		}
+		config := c.current()
+		if err := c.ensureSource(config); err != nil && failed != config {
+			failed = config
+			log.Print(err)
+			chanErr <- err.Error()
+		}
+		if config.filtersErr != nil && invalid != config {
+			invalid = config
+			log.Print(config.filtersErr)
+			chanErr <- config.filtersErr.Error()
+		}
+		if err := c.checkHistory(config); err != nil && truncated != config {
+			truncated = config
+			log.Print(err)
+			chanErr <- err.Error()
+		}
+		if err := c.exporter.listen(config.prometheusListen); err != nil {
+			log.Print(err)
+			chanErr <- err.Error()
+		}
+		dropped := atomic.LoadUint64(&c.stats.droppedSeries)
+		metrics := c.emission(ctx, config)
+		if atomic.LoadUint64(&c.stats.droppedSeries) > dropped && limited != config {
+			// warn once per task config, the dropped_series metric keeps counting
+			limited = config
+			chanErr <- fmt.Sprintf("series limits reached, dropped %d series", atomic.LoadUint64(&c.stats.droppedSeries)-dropped)
+		}
+		select {
+		case mtxOut <- metrics:
+		case <-ctx.Done():
+			return nil
+		}
+		timer.Reset(c.nextDelay(config, &planned, time.Now()))
+	}
+}
 
-			if cont.Spec.HasMemory {
-				for _, key := range c.manifest.memMetrics {
-					m, ok := memMap[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the mem metric map\n", key)
-						continue
-					}
-					metrics = append(metrics, plugin.Metric{
-						Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2]),
-						Description: m.Description,
-						Unit:        m.Unit,
-						Data:        m.Data(cont.Stats[0]),
-						Timestamp:   cont.Stats[0].Timestamp,
-					})
-				}
-			}
+// emission collects the metrics of the next stream emission with the self
+// metrics, and merges them into the exporter while it listens
+func (c *Collector) emission(ctx context.Context, config *snapshot) []plugin.Metric {
+	metrics := c.withSelf(config, c.collectTracked(ctx, config, c.samples, c.series), time.Now())
+	if config.prometheusListen != "" {
+		c.exporter.update(metrics)
+	}
+	return metrics
+}
 
-			if cont.Spec.HasCpu {
-				for _, key := range c.manifest.cpuMetrics {
-					m, ok := cpuMap[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the cpu metric map\n", key)
-						continue
-					}
-					metrics = append(metrics, plugin.Metric{
-						Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2]),
-						Description: m.Description,
-						Unit:        m.Unit,
-						Data:        m.Data(cont.Stats[0]),
-						Timestamp:   cont.Stats[0].Timestamp,
-					})
-				}
-			}
+// nextDelay returns how long to wait before the next emission. Aligned schedules
+// emit on wall clock boundaries of the interval, planned holds the boundary of
+// the last emission so boundaries that passed while collecting or sending are
+// counted as skipped instead of emitted late.
+func (c *Collector) nextDelay(config *snapshot, planned *time.Time, now time.Time) time.Duration {
+	if !config.aligned {
+		*planned = time.Time{}
+		return config.interval
+	}
+	next := now.Truncate(config.interval).Add(config.interval)
+	if !planned.IsZero() {
+		if missed := int64(next.Sub(*planned)/config.interval) - 1; missed > 0 {
+			atomic.AddUint64(&c.stats.overruns, 1)
+			atomic.AddUint64(&c.stats.skippedTicks, uint64(missed))
+		}
+	}
+	*planned = next
+	return next.Sub(now)
+}
 
-			if cont.Spec.HasFilesystem {
-				for _, key := range c.manifest.fsMetrics {
-					m, ok := fsMap[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the fs metric map\n", key)
-						continue
-					}
-					metrics = append(metrics, plugin.Metric{
-						Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2]),
-						Description: m.Description,
-						Unit:        m.Unit,
-						Data:        m.Data(cont.Stats[0]),
-						Timestamp:   cont.Stats[0].Timestamp,
-					})
-				}
+// collect converts the stats of every kubernetes container that were not emitted
+// yet into the metrics requested by the task. Only the latest sample is used
+// unless high resolution is enabled, which backfills every sample cAdvisor took
+// since the last emission, each with its own timestamp. Requested summaries are
+// computed over every sample of the last interval.
+func (c *Collector) collect(config *snapshot) []plugin.Metric {
+	return c.collectTracked(context.Background(), config, c.samples, c.series)
+}
+
+// withSelf appends the self metrics requested by the task at now to the
+// metrics of a collection, with the global tags the series of the collection
+// were named with
+func (c *Collector) withSelf(config *snapshot, metrics []plugin.Metric, now time.Time) []plugin.Metric {
+	n := len(metrics)
+	metrics = c.stats.convert(metrics, config.manifest.self, now)
+	withTags(metrics[n:], c.tags.of(config, c.source()))
+	return metrics
+}
+
+// collectTracked collects like collect, tracking emitted samples in samples and
+// naming series from the cache series. The source is listed and containers are
+// converted by a pool of config.workers goroutines until ctx is done or the
+// collection timeout elapsed. Containers that were not converted by then are
+// left for the next collection and the partial result is returned.
+func (c *Collector) collectTracked(ctx context.Context, config *snapshot, samples *sampleTracker, series *seriesCache) []plugin.Metric {
+	return c.collectContainers(ctx, config, samples, series, nil)
+}
+
+// collectContainers collects like collectTracked, recording why every
+// container that is not collected was skipped in skipped unless it is nil
+func (c *Collector) collectContainers(ctx context.Context, config *snapshot, samples *sampleTracker, series *seriesCache, skipped map[string]string) []plugin.Metric {
+	count := 1
+	if config.highRes || len(config.manifest.stats) > 0 {
+		count = -1
+	}
+	source := c.source()
+	if source == nil {
+		return []plugin.Metric{}
+	}
+	if config.caps != nil {
+		c.stats.caps.Store(config.caps)
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.collectTimeout())
+	defer cancel()
+	containers, err := c.listing.list(ctx, source, count)
+	if err != nil && ctx.Err() != nil {
+		// nothing was converted, every container keeps its state
+		atomic.AddUint64(&c.stats.timeouts, 1)
+		log.Printf("collection deadline exceeded while listing the containers")
+		return []plugin.Metric{}
+	}
+	if err != nil {
+		log.Printf("unable to gather container metrics: %v", err)
+	}
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if skipped != nil {
+		for _, name := range names {
+			if reason := containerSkipReason(containers[name]); reason != "" {
+				skipped[name] = reason
 			}
+		}
+	}
 
-			if cont.Spec.HasDiskIo {
-				for _, key := range c.manifest.diskIoMetrics {
-					m, ok := diskIoMap[key]
-					if !ok {
-						log.Printf("metric: %v does not exist in the fs metric map\n", key)
-						continue
-					}
-					if key == "write_bytes" || key == "read_bytes" {
-						for _, disk := range cont.Stats[0].DiskIo.IoServiceBytes {
-							metrics = append(metrics, plugin.Metric{
-								Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], disk.Device),
-								Description: m.Description,
-								Unit:        m.Unit,
-								Data:        m.Data(disk),
-								Timestamp:   cont.Stats[0].Timestamp,
-							})
-						}
-					}
-					if key == "writes" || key == "reads" {
-						for _, disk := range cont.Stats[0].DiskIo.IoServiced {
-							metrics = append(metrics, plugin.Metric{
-								Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], disk.Device),
-								Description: m.Description,
-								Unit:        m.Unit,
-								Data:        m.Data(disk),
-								Timestamp:   cont.Stats[0].Timestamp,
-							})
-						}
-					}
-					if key == "queued_writes" || key == "queued_reads" {
-						for _, disk := range cont.Stats[0].DiskIo.IoQueued {
-							metrics = append(metrics, plugin.Metric{
-								Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], disk.Device),
-								Description: m.Description,
-								Unit:        m.Unit,
-								Data:        m.Data(disk),
-								Timestamp:   cont.Stats[0].Timestamp,
-							})
-						}
-					}
-					if key == "sector_writes" || key == "sector_reads" {
-						for _, disk := range cont.Stats[0].DiskIo.Sectors {
-							metrics = append(metrics, plugin.Metric{
-								Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], disk.Device),
-								Description: m.Description,
-								Unit:        m.Unit,
-								Data:        m.Data(disk),
-								Timestamp:   cont.Stats[0].Timestamp,
-							})
-						}
-					}
-					if key == "merged_writes" || key == "merged_reads" {
-						for _, disk := range cont.Stats[0].DiskIo.IoMerged {
-							metrics = append(metrics, plugin.Metric{
-								Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], disk.Device),
-								Description: m.Description,
-								Unit:        m.Unit,
-								Data:        m.Data(disk),
-								Timestamp:   cont.Stats[0].Timestamp,
-							})
-						}
-					}
-					if key == "write_time" || key == "read_time" {
-						for _, disk := range cont.Stats[0].DiskIo.IoServiceTime {
-							metrics = append(metrics, plugin.Metric{
-								Namespace:   m.Namespace(contInfo[0], contInfo[1], contInfo[2], disk.Device),
-								Description: m.Description,
-								Unit:        m.Unit,
-								Data:        m.Data(disk),
-								Timestamp:   cont.Stats[0].Timestamp,
-							})
-						}
-					}
-				}
+	series.begin(c.tags.of(config, source))
+	metrics, left := c.convertContainers(ctx, config, samples, series, names, containers)
+	if left > 0 {
+		atomic.AddUint64(&c.stats.timeouts, 1)
+		log.Printf("collection deadline exceeded, %d of %d containers left for the next collection", left, len(names))
+	}
+	series.sweep()
+	samples.commit()
+	return metrics
+}
+
+// convertContainer appends the metrics of the fresh samples of a container to
+// metrics. A container whose conversion is interrupted by ctx keeps its state
+// as if it was not collected, none of its metrics are appended and false is
+// returned.
+func (c *Collector) convertContainer(ctx context.Context, config *snapshot, samples *sampleTracker, cache *seriesCache, name string, cont info.ContainerInfo, metrics []plugin.Metric) ([]plugin.Metric, bool) {
+	if len(cont.Stats) < 1 {
+		log.Printf("no container stats currently available")
+		return metrics, true
+	}
+	contInfo, ok := checkContainer(cont.Spec.Labels)
+	if !ok {
+		return metrics, true
+	}
+	series := cache.container(name, contInfo, config.scheme)
+	fresh := samples.fresh(name, cont.Stats, config.highRes)
+	if len(fresh) == 0 {
+		return metrics, true
+	}
+	start := len(metrics)
+	devices := config.limits.devicesOf(config.resolver, config.filters, config.manifest.metrics, fresh[len(fresh)-1])
+	prev := samples.previous(name)
+	for _, stats := range fresh {
+		if ctx.Err() != nil {
+			samples.keep(name)
+			return metrics[:start], false
+		}
+		for _, m := range config.manifest.metrics {
+			if !m.Requires.supported(cont.Spec) {
+				continue
 			}
+			metrics = m.convert(metrics, series, prev, stats, devices)
 		}
-		c.lock.Unlock()
-		mtxOut <- metrics
-		time.Sleep(c.interval)
+		prev = stats
 	}
+	metrics = convertStats(metrics, config.manifest.stats, series, cont.Spec, cont.Stats, config.interval, devices)
+	if len(devices.dropped) > 0 {
+		atomic.AddUint64(&c.stats.droppedSeries, uint64(len(devices.dropped)))
+	}
+	return metrics, true
 }
 
 func checkContainer(labels map[string]string) ([3]string, bool) {
@@ -312,75 +403,70 @@ func checkContainer(labels map[string]string) ([3]string, bool) {
 	return [3]string{nameSpace, podName, containerName}, true
 }
 
-// GetMetricTypes will be called when your plugin is loaded in order to populate the metric catalog(where snaps stores all
-// available metrics). Config info is passed in. This config information would come from global config snap settings.
-// The metrics returned will be advertised to users who list all the metrics and will become targetable by tasks.
-func (c Collector) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error) {
-	metrics := []plugin.Metric{}
-
-	for _, m := range tcpMap {
-		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*"),
-			Description: m.Description,
-			Unit:        m.Unit,
-			Config:      cfg,
-		})
+// skipReason explains why checkContainer rejects a container, it is empty for
+// containers that are collected
+func skipReason(labels map[string]string) string {
+	for _, label := range []string{KubernetesPodNameLabel, KubernetesPodNamespaceLabel, KubernetesContainerNameLabel} {
+		if _, ok := labels[label]; !ok {
+			return "missing label " + label
+		}
 	}
+	return ""
+}
 
-	for _, m := range tcp6Map {
-		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*"),
-			Description: m.Description,
-			Unit:        m.Unit,
-			Config:      cfg,
-		})
+// containerSkipReason explains why a container is not collected, it is empty
+// for containers that are collected
+func containerSkipReason(cont info.ContainerInfo) string {
+	if reason := skipReason(cont.Spec.Labels); reason != "" {
+		return reason
 	}
-
-	for _, m := range fsMap {
-		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*"),
-			Description: m.Description,
-			Unit:        m.Unit,
-			Config:      cfg,
-		})
+	if len(cont.Stats) < 1 {
+		return "no container stats currently available"
 	}
+	return ""
+}
 
-	for _, m := range cpuMap {
-		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*"),
-			Description: m.Description,
-			Unit:        m.Unit,
-			Config:      cfg,
-		})
+// GetMetricTypes will be called when your plugin is loaded in order to populate the metric catalog(where snaps stores all
+// available metrics). Config info is passed in. This config information would come from global config snap settings.
+// The metrics returned will be advertised to users who list all the metrics and will become targetable by tasks.
+// The catalog is sorted by namespace and leaves out the families the probed host cannot provide unless
+// prune_catalog is unset.
+func (c Collector) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error) {
+	if _, err := deviceFiltersOf(cfg); err != nil {
+		return nil, err
 	}
-
-	for _, m := range memMap {
-		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*"),
-			Description: m.Description,
-			Unit:        m.Unit,
-			Config:      cfg,
-		})
+	scheme := schemeOf(cfg)
+	var caps *capabilities
+	if getBool(cfg, "prune_catalog", true) {
+		caps = capabilitiesOf(getString(cfg, "source", sourceCadvisor), hostPathsOf(cfg))
 	}
-
-	for _, m := range ifaceMap {
+	metrics := catalog(scheme, schemaOf(cfg), caps)
+	for i := range metrics {
+		metrics[i].Config = cfg
+	}
+	advertised := map[string]bool{}
+	for _, r := range statCatalog(cfg) {
+		ns := r.CatalogNamespace(scheme)
+		if !caps.reports(r.metric) || advertised[ns.String()] {
+			continue
+		}
+		advertised[ns.String()] = true
 		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*", "*"),
-			Description: m.Description,
-			Unit:        m.Unit,
+			Namespace:   ns,
+			Description: r.Description(),
+			Unit:        r.Unit(scheme),
 			Config:      cfg,
 		})
 	}
-
-	for _, m := range diskIoMap {
+	for _, m := range selfRegistry {
 		metrics = append(metrics, plugin.Metric{
-			Namespace:   m.Namespace("*", "*", "*", "*"),
+			Namespace:   m.Namespace(),
 			Description: m.Description,
 			Unit:        m.Unit,
 			Config:      cfg,
 		})
 	}
-
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Namespace.String() < metrics[j].Namespace.String() })
 	return metrics, nil
 }
 
@@ -391,14 +477,65 @@ func (c Collector) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error) {
 func (Collector) GetConfigPolicy() (plugin.ConfigPolicy, error) {
 	policy := plugin.NewConfigPolicy()
 	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "interval", false, plugin.SetDefaultInt(15), plugin.SetMinInt(1))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "schedule", false, plugin.SetDefaultString(scheduleInterval))
+	policy.AddNewBoolRule([]string{PluginVendor, PluginName}, "high_resolution", false, plugin.SetDefaultBool(false))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "scheme", false, plugin.SetDefaultString(schemeSnap))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "schema_version", false, plugin.SetDefaultInt(currentSchema), plugin.SetMinInt(schemaV1))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "stats", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "prometheus_listen", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "tags", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "env_tags", false, plugin.SetDefaultString(""))
+	policy.AddNewBoolRule([]string{PluginVendor, PluginName}, "host_tags", false, plugin.SetDefaultBool(true))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "source", false, plugin.SetDefaultString(sourceCadvisor))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "replay_dir", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "record_dir", false, plugin.SetDefaultString(""))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "workers", false, plugin.SetDefaultInt(0), plugin.SetMinInt(0))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "collect_timeout", false, plugin.SetDefaultInt(0), plugin.SetMinInt(0))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "max_series", false, plugin.SetDefaultInt(0), plugin.SetMinInt(0))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "max_devices", false, plugin.SetDefaultInt(0), plugin.SetMinInt(0))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "limit_policy", false, plugin.SetDefaultString(policySorted))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "iface_include", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "iface_exclude", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "disk_include", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "disk_exclude", false, plugin.SetDefaultString(""))
+	policy.AddNewBoolRule([]string{PluginVendor, PluginName}, "prune_catalog", false, plugin.SetDefaultBool(true))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "rootfs", false, plugin.SetDefaultString(defaultRootfs))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "procfs_root", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "sysfs_root", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "cgroup_root", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "docker_socket", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "containerd_socket", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "kubelet_url", false, plugin.SetDefaultString(defaultKubeletURL))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "kubelet_token", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "kubelet_token_file", false, plugin.SetDefaultString(defaultKubeletTokenFile))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "kubelet_ca_file", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "kubelet_cert_file", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "kubelet_key_file", false, plugin.SetDefaultString(""))
+	policy.AddNewBoolRule([]string{PluginVendor, PluginName}, "kubelet_insecure_skip_verify", false, plugin.SetDefaultBool(false))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "kubelet_timeout", false, plugin.SetDefaultInt(int64(defaultKubeletTimeout/time.Second)), plugin.SetMinInt(1))
+	policy.AddNewStringRule([]string{PluginVendor, PluginName}, "cadvisor_url", false, plugin.SetDefaultString(defaultRemoteURL))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "cadvisor_timeout", false, plugin.SetDefaultInt(int64(defaultRemoteTimeout/time.Second)), plugin.SetMinInt(1))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "cadvisor_retries", false, plugin.SetDefaultInt(defaultRemoteRetries), plugin.SetMinInt(0))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "synthetic_containers", false, plugin.SetDefaultInt(100), plugin.SetMinInt(1))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "synthetic_interfaces", false, plugin.SetDefaultInt(1), plugin.SetMinInt(0))
+	policy.AddNewIntRule([]string{PluginVendor, PluginName}, "synthetic_disks", false, plugin.SetDefaultInt(1), plugin.SetMinInt(0))
 	return *policy, nil
 }
 
 // NewCollector returns a new active cadvisor collector
 func NewCollector() *Collector {
+	config := &atomic.Value{}
+	config.Store(&snapshot{interval: defaultInterval, source: sourceCadvisor})
 	return &Collector{
-		lock:     &sync.Mutex{},
-		manifest: Manifest{},
-		interval: time.Second * 15,
+		sourceLock: &sync.Mutex{},
+		config:     config,
+		updated:    make(chan struct{}, 1),
+		stats:      &selfStats{},
+		samples:    newSampleTracker(),
+		series:     newSeriesCache(),
+		exporter:   newExporter(),
+		polling:    newPoller(),
+		tags:       &globalTags{},
+		listing:    &lister{},
 	}
 }
@@ -1,19 +1,268 @@
 package cadvisor
 
 import (
-	"fmt"
+	"context"
+	"flag"
+	"os"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	info "github.com/google/cadvisor/info/v2"
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 )
 
+// TestMain parses the test flags again, the package already parsed an empty
+// command line on init to silence glog, which keeps the testing package from
+// seeing -run, -bench and the like. The capability probe is replaced so the
+// tests do not depend on the privileges they run with.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	probeHost = func(hostPaths) *capabilities { return nil }
+	os.Exit(m.Run())
+}
+
+// fakeSource serves the same kubernetes container on every call, with the
+// samples in stats or a single testStats sample
+type fakeSource struct {
+	delay time.Duration
+	stats []*info.ContainerStats
+	extra map[string]info.ContainerInfo
+	lock  sync.Mutex
+	calls int
+}
+
+func (f *fakeSource) Start() error {
+	return nil
+}
+
+func (f *fakeSource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	f.lock.Lock()
+	f.calls++
+	stats := f.stats
+	f.lock.Unlock()
+	time.Sleep(f.delay)
+	if stats == nil {
+		stats = []*info.ContainerStats{testStats()}
+	}
+	containers := map[string]info.ContainerInfo{
+		"/kubepods/pod1/cont1": info.ContainerInfo{
+			Spec:  f.spec(),
+			Stats: stats,
+		},
+	}
+	for name, cont := range f.extra {
+		containers[name] = cont
+	}
+	return containers, nil
+}
+
+func (f *fakeSource) spec() info.ContainerSpec {
+	return info.ContainerSpec{
+		Labels: map[string]string{
+			KubernetesPodNameLabel:       "pod",
+			KubernetesPodNamespaceLabel:  "ns",
+			KubernetesContainerNameLabel: "cont",
+		},
+		HasCpu:        true,
+		HasMemory:     true,
+		HasNetwork:    true,
+		HasFilesystem: true,
+		HasDiskIo:     true,
+	}
+}
+
+func requestedMetrics(interval int64, namespaces ...plugin.Namespace) []plugin.Metric {
+	metrics := []plugin.Metric{}
+	for _, ns := range namespaces {
+		metrics = append(metrics, plugin.Metric{
+			Namespace: ns,
+			Config:    plugin.Config{"interval": interval},
+		})
+	}
+	return metrics
+}
+
 func TestGetMetricTypes(t *testing.T) {
 	c := NewCollector()
 	metrics, err := c.GetMetricTypes(plugin.Config{})
 	if err != nil {
-		fmt.Println(err)
+		t.Fatal(err)
+	}
+	for i, m := range metrics {
+		ns := m.Namespace.String()
+		if i > 0 && metrics[i-1].Namespace.String() >= ns {
+			t.Errorf("catalog is not sorted, %s follows %s", ns, metrics[i-1].Namespace.String())
+		}
+		if _, ok := lookupSelfMetric(m.Namespace); ok {
+			continue
+		}
+		// the namespace, pod, container and device positions are dynamic
+		for _, e := range m.Namespace {
+			if e.Value == "*" && (!e.IsDynamic() || e.Description == "") {
+				t.Errorf("%s: %q is not a described dynamic element", ns, e.Value)
+			}
+		}
+		if e := m.Namespace.Element(3); e.Name != "namespace" || e.Value != "*" {
+			t.Errorf("%s: expected the kubernetes namespace as dynamic element, got %+v", ns, e)
+		}
+	}
+	again, _ := c.GetMetricTypes(plugin.Config{})
+	if !reflect.DeepEqual(metrics, again) {
+		t.Error("catalog differs between calls")
+	}
+}
+
+func TestManifestUpdateResetsInterval(t *testing.T) {
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mtxIn := make(chan []plugin.Metric)
+	mtxOut := make(chan []plugin.Metric)
+	go c.StreamMetrics(ctx, mtxIn, mtxOut, make(chan string, 1))
+
+	// the first emission happens right away with an empty manifest
+	if metrics := <-mtxOut; len(metrics) != 0 {
+		t.Fatalf("expected no metrics before a manifest was sent, got %d", len(metrics))
+	}
+	mtxIn <- requestedMetrics(3600, registry[0].Namespace("*", "*", "*", "*"))
+	select {
+	case metrics := <-mtxOut:
+		if len(metrics) != 1 {
+			t.Errorf("expected 1 metric after the manifest update, got %d", len(metrics))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("manifest update did not trigger an emission before the interval elapsed")
+	}
+	select {
+	case <-mtxOut:
+		t.Error("unexpected emission before the new interval elapsed")
+	case <-time.After(100 * time.Millisecond):
 	}
-	for _, m := range metrics {
-		fmt.Println(m.Namespace.String())
+}
+
+func TestManifestUpdatesWhileStreaming(t *testing.T) {
+	c := NewCollector()
+	c.mng = &fakeSource{delay: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	mtxIn := make(chan []plugin.Metric)
+	mtxOut := make(chan []plugin.Metric)
+	done := make(chan struct{})
+	go func() {
+		c.StreamMetrics(ctx, mtxIn, mtxOut, make(chan string, 1))
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case metrics := <-mtxOut:
+				if len(metrics) > 2 {
+					t.Errorf("emission mixes manifests: got %d metrics", len(metrics))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		m := registry[i%len(registry)]
+		if i%2 == 0 {
+			mtxIn <- requestedMetrics(1, m.Namespace("*", "*", "*", "*"))
+		} else {
+			mtxIn <- requestedMetrics(3600, m.Namespace("*", "*", "*", "*"), registry[0].Namespace("*", "*", "*", "*"))
+		}
+	}
+	cancel()
+	wg.Wait()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamMetrics did not return after the context was cancelled")
+	}
+}
+
+func TestNextDelayAligned(t *testing.T) {
+	c := NewCollector()
+	config := &snapshot{interval: 10 * time.Second, aligned: true}
+	var planned time.Time
+	start := time.Date(2017, 1, 1, 0, 0, 3, 0, time.UTC)
+
+	if delay := c.nextDelay(config, &planned, start); delay != 7*time.Second {
+		t.Errorf("expected first emission at the next boundary, got delay %v", delay)
+	}
+	// emission finished 2s after its boundary, no overrun
+	if delay := c.nextDelay(config, &planned, planned.Add(2*time.Second)); delay != 8*time.Second {
+		t.Errorf("expected delay of 8s, got %v", delay)
+	}
+	if c.stats.overruns != 0 || c.stats.skippedTicks != 0 {
+		t.Errorf("unexpected overrun: %d overruns, %d skipped ticks", c.stats.overruns, c.stats.skippedTicks)
+	}
+	// emission took 25s, the two boundaries it ran over are skipped
+	if delay := c.nextDelay(config, &planned, planned.Add(25*time.Second)); delay != 5*time.Second {
+		t.Errorf("expected delay of 5s, got %v", delay)
+	}
+	if c.stats.overruns != 1 || c.stats.skippedTicks != 2 {
+		t.Errorf("expected 1 overrun and 2 skipped ticks, got %d and %d", c.stats.overruns, c.stats.skippedTicks)
+	}
+	if planned.Sub(start) != 47*time.Second {
+		t.Errorf("expected next boundary at 00:00:50, got %v", planned)
+	}
+}
+
+func TestNextDelayInterval(t *testing.T) {
+	c := NewCollector()
+	config := &snapshot{interval: 10 * time.Second}
+	planned := time.Now()
+	if delay := c.nextDelay(config, &planned, time.Now()); delay != 10*time.Second || !planned.IsZero() {
+		t.Errorf("expected a plain 10s delay, got %v", delay)
+	}
+}
+
+func statsAt(seconds ...int64) []*info.ContainerStats {
+	stats := []*info.ContainerStats{}
+	for _, sec := range seconds {
+		s := testStats()
+		s.Timestamp = time.Unix(sec, 0)
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func TestCollectFreshSamples(t *testing.T) {
+	for _, highRes := range []bool{false, true} {
+		c := NewCollector()
+		source := &fakeSource{stats: statsAt(10, 20)}
+		c.mng = source
+		config := newSnapshot(requestedMetrics(15, registry[0].Namespace("*", "*", "*", "*")))
+		config.highRes = highRes
+
+		// a new container only emits its latest sample
+		if metrics := c.collect(config); len(metrics) != 1 || metrics[0].Timestamp.Unix() != 20 {
+			t.Errorf("highRes=%v: expected the latest sample only, got %v", highRes, metrics)
+		}
+		// samples that were already emitted are suppressed
+		if metrics := c.collect(config); len(metrics) != 0 {
+			t.Errorf("highRes=%v: expected duplicate samples to be suppressed, got %v", highRes, metrics)
+		}
+		source.stats = statsAt(20, 30, 40)
+		metrics := c.collect(config)
+		expected := []int64{40}
+		if highRes {
+			expected = []int64{30, 40}
+		}
+		if len(metrics) != len(expected) {
+			t.Fatalf("highRes=%v: expected %d metrics, got %d", highRes, len(expected), len(metrics))
+		}
+		for i, m := range metrics {
+			if m.Timestamp.Unix() != expected[i] {
+				t.Errorf("highRes=%v: expected sample at %d, got %d", highRes, expected[i], m.Timestamp.Unix())
+			}
+		}
 	}
 }
@@ -0,0 +1,174 @@
+package cadvisor
+
+import (
+	"log"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// Emission schedules selectable through the "schedule" config
+const (
+	// scheduleInterval waits interval after every emission
+	scheduleInterval = "interval"
+	// scheduleAligned emits on wall clock boundaries of the interval
+	scheduleAligned = "aligned"
+)
+
+// Namespace schemes selectable through the "scheme" config
+const (
+	// schemeSnap names metrics /grafanalabs/cadvisor/container/<namespace>/<pod>/<container>/...
+	schemeSnap = "snap"
+	// schemeCadvisor names metrics like the cAdvisor Prometheus exporter with
+	// namespace, pod, container and devices as tags
+	schemeCadvisor = "cadvisor"
+)
+
+// snapshot is the immutable task configuration used for a collection, a new
+// snapshot replaces the previous one whenever Snap sends a new manifest
+type snapshot struct {
+	manifest Manifest
+	interval time.Duration
+	aligned  bool
+	highRes  bool
+	scheme   string
+	// configured is unset until a task sent its manifest
+	configured bool
+	// source selects the container source, see newSource
+	source    string
+	replayDir string
+	recordDir string
+	synthetic syntheticShape
+	kubelet   kubeletOptions
+	remote    remoteOptions
+	// workers is the number of goroutines converting containers, 0 uses GOMAXPROCS
+	workers int
+	// timeout bounds a collection, 0 uses the interval
+	timeout time.Duration
+	limits  limits
+	// filters select the collected devices, nil collects all of them.
+	// filtersErr is why the filters of the task could not be compiled, every
+	// device is collected then and the error is reported.
+	filters    *deviceFilters
+	filtersErr error
+	// host locates the filesystems of the host
+	host hostPaths
+	// caps are the capabilities of the source, probed on the host of the
+	// cadvisor source. The metrics of the families it disables are not collected.
+	caps *capabilities
+	// resolver names disks after their kernel name
+	resolver *deviceResolver
+	// prometheusListen is the address to serve /metrics on, empty when disabled
+	prometheusListen string
+	// tags are added to every emitted metric, along with the host and
+	// machine_id tags of the source when hostTags is set
+	tags     map[string]string
+	hostTags bool
+}
+
+// newSnapshot builds the task configuration from the metrics requested by Snap
+func newSnapshot(metrics []plugin.Metric) *snapshot {
+	next := &snapshot{configured: true}
+	next.interval = next.manifest.buildMetricsList(metrics)
+	cfg := taskConfig(metrics)
+	switch schedule := getString(cfg, "schedule", scheduleInterval); schedule {
+	case scheduleInterval:
+	case scheduleAligned:
+		next.aligned = true
+	default:
+		log.Printf("unknown schedule %q, using %q\n", schedule, scheduleInterval)
+	}
+	next.highRes = getBool(cfg, "high_resolution", false)
+	next.scheme = schemeOf(cfg)
+	next.prometheusListen = getString(cfg, "prometheus_listen", "")
+	next.tags = tagsOf(cfg)
+	next.hostTags = getBool(cfg, "host_tags", true)
+	next.source = getString(cfg, "source", sourceCadvisor)
+	next.replayDir = getString(cfg, "replay_dir", "")
+	next.recordDir = getString(cfg, "record_dir", "")
+	next.workers = getInt(cfg, "workers", 0)
+	next.timeout = time.Duration(getInt(cfg, "collect_timeout", 0)) * time.Second
+	next.limits = limits{
+		series:  getInt(cfg, "max_series", 0),
+		devices: getInt(cfg, "max_devices", 0),
+		policy:  policyOf(getString(cfg, "limit_policy", policySorted)),
+	}
+	next.filters, next.filtersErr = deviceFiltersOf(cfg)
+	next.host = hostPathsOf(cfg)
+	next.resolver = resolverFor(next.host.sysfs)
+	next.kubelet = kubeletOptionsOf(cfg)
+	next.remote = remoteOptionsOf(cfg)
+	next.caps = capabilitiesOf(next.source, next.host)
+	next.manifest.disable(next.caps)
+	next.synthetic = syntheticShape{
+		containers: getInt(cfg, "synthetic_containers", 100),
+		interfaces: getInt(cfg, "synthetic_interfaces", 1),
+		disks:      getInt(cfg, "synthetic_disks", 1),
+	}
+	return next
+}
+
+// history returns how long the embedded cAdvisor keeps the samples of the
+// containers. Summaries and high resolution need every sample of the interval,
+// so it is raised to the interval when it is longer than storageDuration.
+func (s *snapshot) history() time.Duration {
+	if (s.highRes || len(s.manifest.stats) > 0) && s.interval > storageDuration {
+		return s.interval
+	}
+	return storageDuration
+}
+
+// collectTimeout returns how long a collection may take before it emits the
+// containers converted so far
+func (s *snapshot) collectTimeout() time.Duration {
+	if s.timeout > 0 {
+		return s.timeout
+	}
+	if s.interval > 0 {
+		return s.interval
+	}
+	return defaultInterval
+}
+
+// taskConfig returns the config shared by the metrics of a task
+func taskConfig(metrics []plugin.Metric) plugin.Config {
+	if len(metrics) == 0 {
+		return plugin.Config{}
+	}
+	return metrics[0].Config
+}
+
+func getString(cfg plugin.Config, key string, def string) string {
+	v, err := cfg.GetString(key)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func getInt(cfg plugin.Config, key string, def int) int {
+	v, err := cfg.GetInt(key)
+	if err != nil {
+		return def
+	}
+	return int(v)
+}
+
+func getBool(cfg plugin.Config, key string, def bool) bool {
+	v, err := cfg.GetBool(key)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// schemeOf returns the namespace scheme set in cfg
+func schemeOf(cfg plugin.Config) string {
+	switch scheme := getString(cfg, "scheme", schemeSnap); scheme {
+	case schemeSnap, schemeCadvisor:
+		return scheme
+	default:
+		log.Printf("unknown scheme %q, using %q\n", scheme, schemeSnap)
+		return schemeSnap
+	}
+}
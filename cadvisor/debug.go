@@ -0,0 +1,197 @@
+package cadvisor
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// debugOptions configures a standalone debug run
+type debugOptions struct {
+	count    int
+	interval time.Duration
+	warmup   time.Duration
+	format   string
+	config   plugin.Config
+}
+
+// Debug runs the collector outside of Snap and prints what it would emit for
+// every metric of the catalog, along with the containers it skips. It is meant
+// for troubleshooting on a single node, args are the command line flags.
+func Debug(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.SetOutput(out)
+	opts := debugOptions{}
+	flags.IntVar(&opts.count, "count", 1, "number of intervals to collect before exiting")
+	flags.DurationVar(&opts.interval, "interval", defaultInterval, "time between collections")
+	flags.DurationVar(&opts.warmup, "warmup", 5*time.Second, "time to let cAdvisor gather stats before the first collection")
+	flags.StringVar(&opts.format, "format", "table", "output format, table or json")
+	scheme := flags.String("scheme", schemeSnap, "namespace scheme, snap or cadvisor")
+	highRes := flags.Bool("high_resolution", false, "emit every sample since the last collection")
+	stats := flags.String("stats", "", "summaries per family, e.g. mem:max;cpu:p95")
+	source := flags.String("source", sourceCadvisor, "container source, "+strings.Join(sources, " or "))
+	replayDir := flags.String("replay_dir", "", "directory of recorded collections replayed by the replay source")
+	recordDir := flags.String("record_dir", "", "directory to record every collection to")
+	rootfs := flags.String("rootfs", defaultRootfs, "where the host filesystem is mounted")
+	tags := flags.String("tags", "", "tags added to every metric, e.g. cluster=prod;region=eu")
+	envTags := flags.String("env_tags", "", "tags read from environment variables, e.g. node=NODE_NAME")
+	kubeletURL := flags.String("kubelet_url", defaultKubeletURL, "URL of the kubelet polled by the kubelet source")
+	kubeletTokenFile := flags.String("kubelet_token_file", defaultKubeletTokenFile, "file holding the bearer token of the kubelet source")
+	kubeletInsecure := flags.Bool("kubelet_insecure_skip_verify", false, "skip the verification of the kubelet certificate")
+	cadvisorURL := flags.String("cadvisor_url", defaultRemoteURL, "URLs of the cAdvisor read by the remote source, separated by ;")
+	containers := flags.Int("synthetic_containers", 100, "containers generated by the synthetic source")
+	interfaces := flags.Int("synthetic_interfaces", 1, "interfaces per container generated by the synthetic source")
+	disks := flags.Int("synthetic_disks", 1, "disks per container generated by the synthetic source")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if opts.format != "table" && opts.format != "json" {
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+	opts.config = plugin.Config{
+		"interval":                     int64(opts.interval / time.Second),
+		"scheme":                       *scheme,
+		"high_resolution":              *highRes,
+		"stats":                        *stats,
+		"source":                       *source,
+		"replay_dir":                   *replayDir,
+		"record_dir":                   *recordDir,
+		"rootfs":                       *rootfs,
+		"tags":                         *tags,
+		"env_tags":                     *envTags,
+		"kubelet_url":                  *kubeletURL,
+		"kubelet_token_file":           *kubeletTokenFile,
+		"kubelet_insecure_skip_verify": *kubeletInsecure,
+		"cadvisor_url":                 *cadvisorURL,
+		"synthetic_containers":         int64(*containers),
+		"synthetic_interfaces":         int64(*interfaces),
+		"synthetic_disks":              int64(*disks),
+	}
+	return NewCollector().debug(opts, out)
+}
+
+// debug collects opts.count times and prints the results to out
+func (c *Collector) debug(opts debugOptions, out io.Writer) error {
+	requested, err := c.GetMetricTypes(opts.config)
+	if err != nil {
+		return err
+	}
+	for i := range requested {
+		requested[i].Config = opts.config
+	}
+	config := newSnapshot(requested)
+	if opts.interval <= 0 {
+		opts.interval = config.interval
+	}
+	config.interval = opts.interval
+	if err := c.ensureSource(config); err != nil {
+		return err
+	}
+	time.Sleep(opts.warmup)
+
+	for i := 0; i < opts.count; i++ {
+		if i > 0 {
+			time.Sleep(opts.interval)
+		}
+		// the containers skipped by the first collection are printed before it
+		var skipped map[string]string
+		if i == 0 {
+			skipped = map[string]string{}
+		}
+		metrics := c.collectContainers(context.Background(), config, c.samples, c.series, skipped)
+		if skipped != nil {
+			if err := printSkipped(opts.format, skipped, out); err != nil {
+				return err
+			}
+		}
+		metrics = c.withSelf(config, metrics, time.Now())
+		if err := printMetrics(opts.format, metrics, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printSkipped prints every skipped container with the reason, by name
+func printSkipped(format string, skipped map[string]string, out io.Writer) error {
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	enc := json.NewEncoder(out)
+	if format == "table" {
+		fmt.Fprintln(w, "SKIPPED CONTAINER\tREASON")
+	}
+	for _, name := range names {
+		if format == "json" {
+			if err := enc.Encode(map[string]string{"container": name, "skipped": skipped[name]}); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, skipped[name])
+	}
+	if format == "table" {
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// debugMetric is the JSON representation of an emitted metric
+type debugMetric struct {
+	Namespace string            `json:"namespace"`
+	Value     interface{}       `json:"value"`
+	Unit      string            `json:"unit"`
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// printMetrics prints metrics as JSON lines or as an aligned table
+func printMetrics(format string, metrics []plugin.Metric, out io.Writer) error {
+	sorted := make([]plugin.Metric, len(metrics))
+	copy(sorted, metrics)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Namespace.String() < sorted[j].Namespace.String() })
+
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		for _, m := range sorted {
+			if err := enc.Encode(debugMetric{
+				Namespace: m.Namespace.String(),
+				Value:     m.Data,
+				Unit:      m.Unit,
+				Timestamp: m.Timestamp,
+				Tags:      m.Tags,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tVALUE\tUNIT\tTIMESTAMP\tTAGS")
+	for _, m := range sorted {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\n", m.Namespace.String(), m.Data, m.Unit, m.Timestamp.Format(time.RFC3339), formatTags(m.Tags))
+	}
+	fmt.Fprintln(w)
+	return w.Flush()
+}
+
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
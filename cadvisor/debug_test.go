@@ -0,0 +1,129 @@
+package cadvisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func debugCollector() *Collector {
+	c := NewCollector()
+	c.mng = &fakeSource{extra: map[string]info.ContainerInfo{
+		"/system.slice/docker.service": info.ContainerInfo{
+			Stats: statsAt(10),
+		},
+		"/kubepods/pod1/pause": info.ContainerInfo{
+			Spec: info.ContainerSpec{Labels: map[string]string{
+				KubernetesPodNameLabel:      "pod",
+				KubernetesPodNamespaceLabel: "ns",
+			}},
+			Stats: statsAt(10),
+		},
+	}}
+	return c
+}
+
+func TestDebugJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	opts := debugOptions{count: 1, format: "json", config: plugin.Config{"scheme": schemeSnap}}
+	if err := debugCollector().debug(opts, out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	skipped := map[string]string{}
+	metrics := 0
+	for _, line := range lines {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		if reason, ok := entry["skipped"]; ok {
+			skipped[entry["container"].(string)] = reason.(string)
+			continue
+		}
+		metrics++
+		for _, key := range []string{"namespace", "value", "unit", "timestamp"} {
+			if _, ok := entry[key]; !ok {
+				t.Errorf("%s missing from %q", key, line)
+			}
+		}
+	}
+	if skipped["/system.slice/docker.service"] != "missing label "+KubernetesPodNameLabel {
+		t.Errorf("unexpected reason for docker.service: %q", skipped["/system.slice/docker.service"])
+	}
+	if skipped["/kubepods/pod1/pause"] != "missing label "+KubernetesContainerNameLabel {
+		t.Errorf("unexpected reason for pause: %q", skipped["/kubepods/pod1/pause"])
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected 2 skipped containers, got %v", skipped)
+	}
+	// every registry metric plus the self metrics
+	if metrics != len(expectedValues)+len(selfRegistry) {
+		t.Errorf("expected %d metrics, got %d", len(expectedValues)+len(selfRegistry), metrics)
+	}
+}
+
+func TestDebugTable(t *testing.T) {
+	out := &bytes.Buffer{}
+	opts := debugOptions{count: 1, format: "table", config: plugin.Config{"scheme": schemeCadvisor}}
+	if err := debugCollector().debug(opts, out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"SKIPPED CONTAINER",
+		"/kubepods/pod1/pause",
+		"NAMESPACE",
+		"/container_memory_working_set_bytes",
+		"container=cont,host=",
+		"interface=eth0,namespace=ns,pod=pod",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%q missing from output:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestDebugReplayStartsWithFirstRecording(t *testing.T) {
+	out := &bytes.Buffer{}
+	opts := debugOptions{count: 1, format: "json", config: plugin.Config{
+		"source":     sourceReplay,
+		"replay_dir": filepath.Join("testdata", "replay", "kubernetes"),
+		"sysfs_root": filepath.Join("testdata", "sysfs"),
+	}}
+	if err := NewCollector().debug(opts, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"container":"/kubepods","skipped"`) {
+		t.Errorf("expected the skipped containers of the first recording:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "2017-10-02T10:00:00Z") || strings.Contains(out.String(), "2017-10-02T10:00:10Z") {
+		t.Errorf("expected the metrics of the first recording only:\n%s", out.String())
+	}
+}
+
+func TestDebugRecordsEveryCollectionOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-debug-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := debugOptions{count: 2, interval: time.Millisecond, format: "json", config: plugin.Config{
+		"source":               sourceSynthetic,
+		"synthetic_containers": int64(2),
+		"record_dir":           dir,
+	}}
+	if err := NewCollector().debug(opts, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := recordings(dir); len(files) != 2 {
+		t.Errorf("expected a recording per collection, got %v", files)
+	}
+}
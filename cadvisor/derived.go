@@ -0,0 +1,118 @@
+package cadvisor
+
+import (
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+)
+
+// diskDerived walks the disks listed by list in s, calling derive with the
+// disk stats of both samples and the time elapsed between them. Nothing is
+// derived when the samples are not in order or prev has no disk stats.
+func diskDerived(list func(d *v1.DiskIoStats) []v1.PerDiskStats, derive func(prev, s *v1.DiskIoStats, disk v1.PerDiskStats, elapsed time.Duration) (float64, bool)) DeviceDeriver {
+	return func(prev, s *info.ContainerStats, emit func(d Device, v interface{})) {
+		if prev.DiskIo == nil || s.DiskIo == nil {
+			return
+		}
+		elapsed := s.Timestamp.Sub(prev.Timestamp)
+		if elapsed <= 0 {
+			return
+		}
+		for _, disk := range list(s.DiskIo) {
+			if v, ok := derive(prev.DiskIo, s.DiskIo, disk, elapsed); ok {
+				emit(Device{Name: disk.Device, Major: disk.Major, Minor: disk.Minor}, v)
+			}
+		}
+	}
+}
+
+// diskDelta returns how much the op value of disk listed by list grew from
+// prev to s, it fails when either sample misses the disk or the counter was
+// reset in between
+func diskDelta(list func(d *v1.DiskIoStats) []v1.PerDiskStats, prev, s *v1.DiskIoStats, disk v1.PerDiskStats, op string) (float64, bool) {
+	before, ok := diskValue(list(prev), disk, op)
+	if !ok {
+		return 0, false
+	}
+	after, ok := diskValue(list(s), disk, op)
+	if !ok || after < before {
+		return 0, false
+	}
+	return float64(after - before), true
+}
+
+// diskValue finds the op value of disk in stats by device number
+func diskValue(stats []v1.PerDiskStats, disk v1.PerDiskStats, op string) (uint64, bool) {
+	for _, d := range stats {
+		if d.Major == disk.Major && d.Minor == disk.Minor {
+			v, ok := d.Stats[op]
+			return v, ok
+		}
+	}
+	return 0, false
+}
+
+// diskRate derives the per second rate of the op value listed by list
+func diskRate(list func(d *v1.DiskIoStats) []v1.PerDiskStats, op string) DeviceDeriver {
+	return diskDerived(list, func(prev, s *v1.DiskIoStats, disk v1.PerDiskStats, elapsed time.Duration) (float64, bool) {
+		delta, ok := diskDelta(list, prev, s, disk, op)
+		return delta / elapsed.Seconds(), ok
+	})
+}
+
+// diskLatency derives the average service time of the op requests completed
+// between samples, zero when none completed
+func diskLatency(op string) DeviceDeriver {
+	return diskDerived(ioServiced, func(prev, s *v1.DiskIoStats, disk v1.PerDiskStats, elapsed time.Duration) (float64, bool) {
+		serviced, ok := diskDelta(ioServiced, prev, s, disk, op)
+		if !ok {
+			return 0, false
+		}
+		serviceTime, ok := diskDelta(ioServiceTime, prev, s, disk, op)
+		if !ok {
+			return 0, false
+		}
+		if serviced == 0 {
+			return 0, true
+		}
+		return serviceTime / serviced, true
+	})
+}
+
+// diskQueueDepth derives the average number of requests waiting for or in
+// service between samples, which is the time all of them spent there over
+// the elapsed time
+func diskQueueDepth() DeviceDeriver {
+	return diskDerived(ioServiceTime, func(prev, s *v1.DiskIoStats, disk v1.PerDiskStats, elapsed time.Duration) (float64, bool) {
+		busy, ok := diskDelta(ioServiceTime, prev, s, disk, "Total")
+		if !ok {
+			return 0, false
+		}
+		// wait times are only known to some io schedulers
+		if wait, ok := diskDelta(ioWaitTime, prev, s, disk, "Total"); ok {
+			busy += wait
+		}
+		return busy / float64(elapsed), true
+	})
+}
+
+// diskUtilization derives the percentage of the elapsed time the disk was
+// busy with requests of the container. It is read from the disk time of the
+// io scheduler, or estimated from the service time capped at 100% when the
+// scheduler does not account it.
+func diskUtilization() DeviceDeriver {
+	return diskDerived(ioServiceTime, func(prev, s *v1.DiskIoStats, disk v1.PerDiskStats, elapsed time.Duration) (float64, bool) {
+		if busy, ok := diskDelta(ioTime, prev, s, disk, "Count"); ok {
+			return 100 * busy * float64(time.Millisecond) / float64(elapsed), true
+		}
+		busy, ok := diskDelta(ioServiceTime, prev, s, disk, "Total")
+		if !ok {
+			return 0, false
+		}
+		if busy > float64(elapsed) {
+			busy = float64(elapsed)
+		}
+		return 100 * busy / float64(elapsed), true
+	})
+}
@@ -0,0 +1,114 @@
+package cadvisor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// diskSample returns stats of sda at second t whose disk counters are scaled by n
+func diskSample(t int64, n uint64, withTime bool) *info.ContainerStats {
+	disk := func(read, write uint64) []v1.PerDiskStats {
+		return []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": read, "Write": write, "Total": read + write}}}
+	}
+	s := &info.ContainerStats{
+		Timestamp: time.Unix(t, 0),
+		DiskIo: &v1.DiskIoStats{
+			IoServiceBytes: disk(n*4096, n*8192),
+			IoServiced:     disk(n, n*2),
+			IoServiceTime:  disk(n*uint64(time.Millisecond), n*uint64(3*time.Millisecond)),
+		},
+	}
+	if withTime {
+		s.DiskIo.IoWaitTime = disk(n*uint64(time.Millisecond), 0)
+		s.DiskIo.IoTime = []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Count": n * 10}}}
+	}
+	return s
+}
+
+// derive converts every derived registry metric between prev and s
+func derive(prev, s *info.ContainerStats) map[string]interface{} {
+	prefix := containerNamespace("ns", "pod", "cont").String() + "/"
+	values := map[string]interface{}{}
+	for _, m := range registry {
+		if m.Derive == nil {
+			continue
+		}
+		for _, metric := range m.convert(nil, newContainerSeries([3]string{"ns", "pod", "cont"}, schemeSnap), prev, s, nil) {
+			values[metric.Namespace.String()[len(prefix):]] = metric.Data
+		}
+	}
+	return values
+}
+
+func TestDerivedDiskMetrics(t *testing.T) {
+	// 100 reads and 200 writes completed over 10s
+	values := derive(diskSample(10, 100, false), diskSample(20, 200, false))
+	expected := map[string]float64{
+		"diskio/sda/read_latency":     1e6,
+		"diskio/sda/write_latency":    1.5e6,
+		"diskio/sda/read_iops":        10,
+		"diskio/sda/write_iops":       20,
+		"diskio/sda/read_throughput":  40960,
+		"diskio/sda/write_throughput": 81920,
+		// 400ms of service time over 10s
+		"diskio/sda/queue_depth": 0.04,
+		"diskio/sda/utilization": 4,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("expected %d derived metrics, got %v", len(expected), values)
+	}
+	for name, want := range expected {
+		if got, ok := values[name].(float64); !ok || math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", name, want, values[name])
+		}
+	}
+
+	// wait times add to the queue, the disk time of the scheduler is preferred
+	values = derive(diskSample(10, 100, true), diskSample(20, 200, true))
+	if got := values["diskio/sda/queue_depth"]; got != 0.05 {
+		t.Errorf("queue_depth: expected 0.05 with wait times, got %v", got)
+	}
+	if got := values["diskio/sda/utilization"]; got != 10.0 {
+		t.Errorf("utilization: expected 10 from the disk time, got %v", got)
+	}
+
+	// no request completed in between
+	values = derive(diskSample(10, 100, false), diskSample(20, 100, false))
+	if values["diskio/sda/read_latency"] != 0.0 || values["diskio/sda/read_iops"] != 0.0 {
+		t.Errorf("expected idle disk metrics, got %v", values)
+	}
+
+	for _, c := range []struct {
+		name       string
+		prev, next *info.ContainerStats
+	}{
+		{"first sample", nil, diskSample(20, 200, false)},
+		{"counter reset", diskSample(10, 200, false), diskSample(20, 100, false)},
+		{"samples out of order", diskSample(20, 100, false), diskSample(10, 200, false)},
+		{"disk appeared", &info.ContainerStats{Timestamp: time.Unix(10, 0), DiskIo: &v1.DiskIoStats{}}, diskSample(20, 200, false)},
+	} {
+		if values := derive(c.prev, c.next); len(values) != 0 {
+			t.Errorf("%s: expected nothing derived, got %v", c.name, values)
+		}
+	}
+}
+
+func TestDerivedDiskMetricsCollected(t *testing.T) {
+	c := NewCollector()
+	source := &fakeSource{stats: []*info.ContainerStats{diskSample(10, 100, false)}}
+	c.mng = source
+	config := newSnapshot(requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "read_iops")))
+	if metrics := c.collect(config); len(metrics) != 0 {
+		t.Errorf("expected nothing derived from the first collection, got %v", metrics)
+	}
+	source.stats = []*info.ContainerStats{diskSample(20, 200, false)}
+	metrics := c.collect(config)
+	if len(metrics) != 1 || metrics[0].Data != 10.0 || !metrics[0].Timestamp.Equal(time.Unix(20, 0)) {
+		t.Errorf("expected 10 reads per second from the previous collection, got %v", metrics)
+	}
+}
@@ -0,0 +1,119 @@
+package cadvisor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// filter keeps the names matching any include pattern, or every name when
+// there is none, unless they match an exclude pattern
+type filter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newFilter compiles the include and exclude lists, patterns of a list are
+// separated by ";"
+func newFilter(include, exclude string) (filter, error) {
+	var f filter
+	var err error
+	if f.include, err = compilePatterns(include); err != nil {
+		return filter{}, err
+	}
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return filter{}, err
+	}
+	return f, nil
+}
+
+func compilePatterns(list string) ([]*regexp.Regexp, error) {
+	patterns := []*regexp.Regexp{}
+	for _, p := range strings.Split(list, ";") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		// patterns match whole names, like eth0 not matching veth0
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid device pattern %q: %v", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+func (f filter) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// keeps reports whether a device known by any of names is kept
+func (f filter) keeps(names ...string) bool {
+	included := len(f.include) == 0
+	for _, name := range names {
+		for _, re := range f.exclude {
+			if re.MatchString(name) {
+				return false
+			}
+		}
+		for _, re := range f.include {
+			included = included || re.MatchString(name)
+		}
+	}
+	return included
+}
+
+// deviceFilters select the interfaces and disks that are collected
+type deviceFilters struct {
+	iface filter
+	disk  filter
+}
+
+// newDeviceFilters compiles the filters of the task config, it is nil when
+// every device is collected
+func newDeviceFilters(ifaceInclude, ifaceExclude, diskInclude, diskExclude string) (*deviceFilters, error) {
+	iface, err := newFilter(ifaceInclude, ifaceExclude)
+	if err != nil {
+		return nil, err
+	}
+	disk, err := newFilter(diskInclude, diskExclude)
+	if err != nil {
+		return nil, err
+	}
+	if iface.empty() && disk.empty() {
+		return nil, nil
+	}
+	return &deviceFilters{iface: iface, disk: disk}, nil
+}
+
+// deviceFiltersOf compiles the device filters set in cfg
+func deviceFiltersOf(cfg plugin.Config) (*deviceFilters, error) {
+	filters, err := newDeviceFilters(
+		getString(cfg, "iface_include", ""), getString(cfg, "iface_exclude", ""),
+		getString(cfg, "disk_include", ""), getString(cfg, "disk_exclude", ""),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("device filters: %v", err)
+	}
+	return filters, nil
+}
+
+// allows reports whether device d of family is collected, interfaces match by
+// name and disks by name or major:minor
+func (f *deviceFilters) allows(family string, d Device) bool {
+	if f == nil {
+		return true
+	}
+	switch family {
+	case "iface":
+		return f.iface.keeps(d.Name)
+	case "diskio":
+		if f.disk.empty() {
+			return true
+		}
+		return f.disk.keeps(d.Name, fmt.Sprintf("%d:%d", d.Major, d.Minor))
+	}
+	return true
+}
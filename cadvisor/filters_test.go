@@ -0,0 +1,113 @@
+package cadvisor
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := newFilter("eth.*; en.*", "eth1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"eth0":  true,
+		"eth1":  false,
+		"ens3":  true,
+		"veth0": false,
+		"lo":    false,
+	} {
+		if f.keeps(name) != expected {
+			t.Errorf("%s: expected kept=%v", name, expected)
+		}
+	}
+	if _, err := newFilter("eth[", ""); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if filters, err := newDeviceFilters("", "", "", ""); filters != nil || err != nil {
+		t.Errorf("expected no filters without patterns, got %v, %v", filters, err)
+	}
+}
+
+func TestDeviceFilters(t *testing.T) {
+	s := testStats()
+	s.Network.Interfaces = []v1.InterfaceStats{{Name: "eth0"}, {Name: "lo"}, {Name: "veth1a2b"}}
+	disk := func(name string, major, minor uint64) v1.PerDiskStats {
+		return v1.PerDiskStats{Device: name, Major: major, Minor: minor, Stats: map[string]uint64{"Read": 1, "Write": 2}}
+	}
+	s.DiskIo = &v1.DiskIoStats{IoServiceBytes: []v1.PerDiskStats{
+		disk("sda", 8, 0), disk("sdb", 8, 16), disk("dm-0", 253, 0), disk("loop0", 7, 0), disk("ram0", 1, 0),
+	}}
+	c := NewCollector()
+	c.mng = &fakeSource{stats: []*info.ContainerStats{s}}
+	requested := requestedMetrics(15,
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "iface", "*", "in_bytes"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "read_bytes"),
+	)
+	for i := range requested {
+		requested[i].Config = plugin.Config{
+			"iface_exclude": "lo;veth.*",
+			"disk_include":  "8:.*;ram0",
+			"disk_exclude":  "sdb",
+			"max_devices":   int64(1),
+			"sysfs_root":    filepath.Join("testdata", "sysfs"),
+		}
+	}
+	metrics := c.collect(newSnapshot(requested))
+	devices := map[string]bool{}
+	for _, m := range metrics {
+		devices[m.Namespace.Element(familyIndex+1).Value] = true
+	}
+	// sda is filtered in but dropped by max_devices in favor of ram0
+	if len(devices) != 2 || !devices["eth0"] || !devices["ram0"] {
+		t.Errorf("expected eth0 and ram0, got %v", devices)
+	}
+	if c.stats.droppedSeries != 1 {
+		t.Errorf("expected only sda to count as dropped, got %d", c.stats.droppedSeries)
+	}
+}
+
+func TestInvalidDeviceFilters(t *testing.T) {
+	cfg := plugin.Config{"interval": int64(3600), "disk_exclude": "dm-["}
+	if _, err := (Collector{}).GetMetricTypes(cfg); err == nil || !strings.Contains(err.Error(), "dm-[") {
+		t.Errorf("expected the catalog to reject the invalid pattern, got %v", err)
+	}
+
+	requested := requestedMetrics(3600, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "read_bytes"))
+	requested[0].Config = cfg
+	polled := NewCollector()
+	polled.mng = &fakeSource{}
+	if _, err := polled.CollectMetrics(requested); err == nil || !strings.Contains(err.Error(), "dm-[") {
+		t.Errorf("expected polling to fail on the invalid pattern, got %v", err)
+	}
+
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mtxIn := make(chan []plugin.Metric)
+	mtxOut := make(chan []plugin.Metric)
+	chanErr := make(chan string, 1)
+	go c.StreamMetrics(ctx, mtxIn, mtxOut, chanErr)
+
+	<-mtxOut
+	mtxIn <- requested
+	select {
+	case err := <-chanErr:
+		if !strings.Contains(err, "dm-[") {
+			t.Errorf("unexpected error %q", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error sent for the invalid pattern")
+	}
+	if metrics := <-mtxOut; len(metrics) != 1 {
+		t.Errorf("expected every disk to be collected, got %v", metrics)
+	}
+}
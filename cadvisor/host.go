@@ -0,0 +1,250 @@
+package cadvisor
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/cadvisor/utils/sysfs"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// defaultRootfs is where the host filesystem is found unless configured
+// otherwise, it is typically /rootfs when the plugin runs in a container
+const defaultRootfs = "/"
+
+// hostPaths locates the host filesystems and sockets the plugin reads. Paths
+// that are not configured are found below rootfs at their usual place.
+type hostPaths struct {
+	rootfs string
+	procfs string
+	sysfs  string
+	cgroup string
+	// the sockets are empty unless configured, see docker and containerd
+	dockerSocket     string
+	containerdSocket string
+}
+
+// hostPathsOf reads the host paths set in cfg
+func hostPathsOf(cfg plugin.Config) hostPaths {
+	rootfs := getString(cfg, "rootfs", "")
+	if rootfs == "" {
+		rootfs = defaultRootfs
+	}
+	under := func(key string, path string) string {
+		if v := getString(cfg, key, ""); v != "" {
+			return v
+		}
+		return filepath.Join(rootfs, path)
+	}
+	return hostPaths{
+		rootfs:           rootfs,
+		procfs:           under("procfs_root", "proc"),
+		sysfs:            under("sysfs_root", "sys"),
+		cgroup:           under("cgroup_root", "sys/fs/cgroup"),
+		dockerSocket:     getString(cfg, "docker_socket", ""),
+		containerdSocket: getString(cfg, "containerd_socket", ""),
+	}
+}
+
+// docker returns the Docker socket, the usual one below rootfs unless configured
+func (h hostPaths) docker() string {
+	if h.dockerSocket != "" {
+		return h.dockerSocket
+	}
+	return filepath.Join(h.rootfs, "var/run/docker.sock")
+}
+
+// containerd returns the containerd socket, the usual one below rootfs unless configured
+func (h hostPaths) containerd() string {
+	if h.containerdSocket != "" {
+		return h.containerdSocket
+	}
+	return filepath.Join(h.rootfs, "run/containerd/containerd.sock")
+}
+
+// validate checks that the host filesystems exist, and so do the sockets
+// that were configured. A node may run only one of the container runtimes,
+// so the sockets are not required at their usual place. The paths the source
+// cannot be pointed to are rejected as well, see cadvisorUnsupported.
+func (h hostPaths) validate(source string) error {
+	problems := []string{}
+	for _, dir := range []struct{ key, path string }{
+		{"rootfs", h.rootfs},
+		{"procfs_root", h.procfs},
+		{"sysfs_root", h.sysfs},
+		{"cgroup_root", h.cgroup},
+	} {
+		info, err := os.Stat(dir.path)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", dir.key, err))
+		case !info.IsDir():
+			problems = append(problems, fmt.Sprintf("%s: %s is not a directory", dir.key, dir.path))
+		}
+	}
+	for _, socket := range []struct{ key, path string }{
+		{"docker_socket", h.dockerSocket},
+		{"containerd_socket", h.containerdSocket},
+	} {
+		if socket.path == "" {
+			continue
+		}
+		if _, err := os.Stat(socket.path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", socket.key, err))
+		}
+	}
+	if source == sourceCadvisor {
+		problems = append(problems, h.cadvisorUnsupported()...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid host paths: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// cadvisorUnsupported describes the host paths the embedded cAdvisor cannot be
+// pointed to. It finds the cgroup hierarchies in the mount table of the plugin
+// and reads processes from /proc, or from /rootfs/proc when the host is mounted
+// at /rootfs, whatever procfs_root and cgroup_root are set to.
+func (h hostPaths) cadvisorUnsupported() []string {
+	unsupported := []string{}
+	for _, path := range []struct {
+		key     string
+		path    string
+		allowed []string
+	}{
+		{"procfs_root", h.procfs, []string{"/proc", "/rootfs/proc"}},
+		{"cgroup_root", h.cgroup, []string{"/sys/fs/cgroup", "/rootfs/sys/fs/cgroup"}},
+	} {
+		honored := false
+		for _, allowed := range path.allowed {
+			honored = honored || filepath.Clean(path.path) == allowed
+		}
+		if !honored {
+			unsupported = append(unsupported, fmt.Sprintf("%s: cAdvisor cannot read %s, only %s", path.key, path.path, strings.Join(path.allowed, " or ")))
+		}
+	}
+	return unsupported
+}
+
+// configureRuntimes points the container runtime clients of cAdvisor to the
+// sockets of the host, which cAdvisor reads from its command line flags.
+// Sockets missing at their usual place keep the cAdvisor defaults.
+func (h hostPaths) configureRuntimes() {
+	if socket := h.docker(); exists(socket) {
+		setCadvisorFlag("docker", "unix://"+socket)
+	}
+	if socket := h.containerd(); exists(socket) {
+		setCadvisorFlag("containerd", socket)
+	}
+}
+
+// setCadvisorFlag sets a command line flag of cAdvisor, flags the vendored
+// cAdvisor does not know are logged and ignored
+func setCadvisorFlag(name, value string) {
+	if flag.Lookup(name) == nil {
+		log.Printf("cAdvisor has no %s flag, ignoring %s\n", name, value)
+		return
+	}
+	if err := flag.Set(name, value); err != nil {
+		log.Printf("failed to set cAdvisor flag %s: %v\n", name, err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// hostSysFs reads the block and network devices and the machine id from the
+// sysfs of the host mounted at root instead of /sys. CPU caches are read by
+// the embedded sysfs, their topology is the same within a container.
+type hostSysFs struct {
+	sysfs.SysFs
+	root string
+}
+
+// newHostSysFs returns the sysfs cAdvisor reads the machine from
+func newHostSysFs(root string) sysfs.SysFs {
+	if filepath.Clean(root) == "/sys" {
+		return sysfs.NewRealSysFs()
+	}
+	return &hostSysFs{SysFs: sysfs.NewRealSysFs(), root: root}
+}
+
+func (s *hostSysFs) read(elem ...string) (string, error) {
+	out, err := ioutil.ReadFile(filepath.Join(append([]string{s.root}, elem...)...))
+	return string(out), err
+}
+
+func (s *hostSysFs) GetBlockDevices() ([]os.FileInfo, error) {
+	return ioutil.ReadDir(filepath.Join(s.root, "block"))
+}
+
+func (s *hostSysFs) GetBlockDeviceSize(name string) (string, error) {
+	return s.read("block", name, "size")
+}
+
+func (s *hostSysFs) GetBlockDeviceScheduler(name string) (string, error) {
+	return s.read("block", name, "queue", "scheduler")
+}
+
+func (s *hostSysFs) GetBlockDeviceNumbers(name string) (string, error) {
+	return s.read("block", name, "dev")
+}
+
+// GetNetworkDevices lists the directories of the interfaces, following the
+// links sysfs uses for them
+func (s *hostSysFs) GetNetworkDevices() ([]os.FileInfo, error) {
+	dir := filepath.Join(s.root, "class", "net")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	devices := []os.FileInfo{}
+	for _, f := range files {
+		if f.Mode()&os.ModeSymlink != 0 {
+			if f, err = os.Stat(filepath.Join(dir, f.Name())); err != nil {
+				continue
+			}
+		}
+		if f.IsDir() {
+			devices = append(devices, f)
+		}
+	}
+	return devices, nil
+}
+
+func (s *hostSysFs) GetNetworkAddress(name string) (string, error) {
+	return s.read("class", "net", name, "address")
+}
+
+func (s *hostSysFs) GetNetworkMtu(name string) (string, error) {
+	return s.read("class", "net", name, "mtu")
+}
+
+func (s *hostSysFs) GetNetworkSpeed(name string) (string, error) {
+	return s.read("class", "net", name, "speed")
+}
+
+func (s *hostSysFs) GetNetworkStatValue(dev string, stat string) (uint64, error) {
+	out, err := s.read("class", "net", dev, "statistics", stat)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	if _, err := fmt.Sscanf(out, "%d", &v); err != nil {
+		return 0, fmt.Errorf("could not parse %s of %s: %v", stat, dev, err)
+	}
+	return v, nil
+}
+
+func (s *hostSysFs) GetSystemUUID() (string, error) {
+	id, err := s.read("class", "dmi", "id", "product_uuid")
+	return strings.TrimSpace(id), err
+}
@@ -0,0 +1,155 @@
+package cadvisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// fakeRootfs creates a host filesystem with proc, sys and cgroup directories
+func fakeRootfs(t *testing.T) string {
+	root, err := ioutil.TempDir("", "cadvisor-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"proc", "sys/fs/cgroup", "sys/block/sda", "sys/class/net/eth0/statistics"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, content := range map[string]string{
+		"sys/block/sda/dev":                      "8:0\n",
+		"sys/class/net/eth0/mtu":                 "1500\n",
+		"sys/class/net/eth0/statistics/rx_bytes": "1234\n",
+		"sys/class/net/not_a_device":             "",
+		"sys/class/dmi/id/product_uuid":          "4c4c4544-0042\n",
+	} {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestHostPaths(t *testing.T) {
+	host := hostPathsOf(plugin.Config{"rootfs": "/rootfs", "cgroup_root": "/cgroup", "docker_socket": "/docker.sock"})
+	expected := hostPaths{
+		rootfs:       "/rootfs",
+		procfs:       "/rootfs/proc",
+		sysfs:        "/rootfs/sys",
+		cgroup:       "/cgroup",
+		dockerSocket: "/docker.sock",
+	}
+	if host != expected {
+		t.Errorf("expected %+v, got %+v", expected, host)
+	}
+	if host.docker() != "/docker.sock" || host.containerd() != "/rootfs/run/containerd/containerd.sock" {
+		t.Errorf("unexpected sockets %s and %s", host.docker(), host.containerd())
+	}
+	if host := hostPathsOf(plugin.Config{}); host.procfs != "/proc" || host.sysfs != "/sys" || host.cgroup != "/sys/fs/cgroup" {
+		t.Errorf("expected the host paths of the root filesystem, got %+v", host)
+	}
+}
+
+func TestHostPathsValidate(t *testing.T) {
+	root := fakeRootfs(t)
+	defer os.RemoveAll(root)
+	// sockets missing at their usual place are fine
+	if err := hostPathsOf(plugin.Config{"rootfs": root}).validate(sourceCgroupfs); err != nil {
+		t.Errorf("expected a valid host, got %v", err)
+	}
+	host := hostPathsOf(plugin.Config{
+		"rootfs":        root,
+		"procfs_root":   filepath.Join(root, "missing"),
+		"sysfs_root":    filepath.Join(root, "sys/block/sda/dev"),
+		"docker_socket": filepath.Join(root, "var/run/docker.sock"),
+	})
+	err := host.validate(sourceCgroupfs)
+	if err == nil {
+		t.Fatal("expected invalid host paths")
+	}
+	for _, key := range []string{"procfs_root", "sysfs_root", "docker_socket"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected %s to be reported, got %v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "cgroup_root") {
+		t.Errorf("cgroup_root exists, got %v", err)
+	}
+
+	c := NewCollector()
+	config := newSnapshot(requestAll(plugin.Config{"rootfs": filepath.Join(root, "missing")}))
+	if err := c.ensureSource(config); err == nil || !strings.Contains(err.Error(), "rootfs") {
+		t.Errorf("expected the cadvisor source to fail on a missing rootfs, got %v", err)
+	}
+}
+
+func TestCadvisorUnsupported(t *testing.T) {
+	for _, c := range []struct {
+		cfg         plugin.Config
+		unsupported string
+	}{
+		{plugin.Config{}, ""},
+		{plugin.Config{"rootfs": "/rootfs/"}, ""},
+		{plugin.Config{"rootfs": "/host"}, "procfs_root,cgroup_root"},
+		{plugin.Config{"rootfs": "/host", "procfs_root": "/proc", "cgroup_root": "/sys/fs/cgroup"}, ""},
+		{plugin.Config{"rootfs": "/rootfs", "procfs_root": "/host/proc", "sysfs_root": "/host/sys"}, "procfs_root"},
+		{plugin.Config{"cgroup_root": "/cgroup"}, "cgroup_root"},
+	} {
+		keys := []string{}
+		for _, problem := range hostPathsOf(c.cfg).cadvisorUnsupported() {
+			keys = append(keys, strings.SplitN(problem, ":", 2)[0])
+		}
+		if unsupported := strings.Join(keys, ","); unsupported != c.unsupported {
+			t.Errorf("%v: expected %q to be unsupported, got %q", c.cfg, c.unsupported, unsupported)
+		}
+	}
+
+	// the cgroupfs source reads any root, cAdvisor rejects them
+	root := fakeRootfs(t)
+	defer os.RemoveAll(root)
+	host := hostPathsOf(plugin.Config{"rootfs": root})
+	if err := host.validate(sourceCgroupfs); err != nil {
+		t.Errorf("expected a valid host for cgroupfs, got %v", err)
+	}
+	err := host.validate(sourceCadvisor)
+	if err == nil || !strings.Contains(err.Error(), "procfs_root") || !strings.Contains(err.Error(), "cgroup_root") {
+		t.Errorf("expected cAdvisor to reject procfs_root and cgroup_root, got %v", err)
+	}
+	c := NewCollector()
+	if err := c.ensureSource(newSnapshot(requestAll(plugin.Config{"rootfs": root}))); err == nil || !strings.Contains(err.Error(), "procfs_root") {
+		t.Errorf("expected the cadvisor source to fail on unsupported paths, got %v", err)
+	}
+}
+
+func TestHostSysFs(t *testing.T) {
+	root := fakeRootfs(t)
+	defer os.RemoveAll(root)
+	fs := newHostSysFs(filepath.Join(root, "sys"))
+	if disks, err := fs.GetBlockDevices(); err != nil || len(disks) != 1 || disks[0].Name() != "sda" {
+		t.Errorf("expected sda, got %v (%v)", disks, err)
+	}
+	if dev, err := fs.GetBlockDeviceNumbers("sda"); err != nil || dev != "8:0\n" {
+		t.Errorf("expected 8:0, got %q (%v)", dev, err)
+	}
+	if ifaces, err := fs.GetNetworkDevices(); err != nil || len(ifaces) != 1 || ifaces[0].Name() != "eth0" {
+		t.Errorf("expected eth0 only, got %v (%v)", ifaces, err)
+	}
+	if rx, err := fs.GetNetworkStatValue("eth0", "rx_bytes"); err != nil || rx != 1234 {
+		t.Errorf("expected 1234 received bytes, got %d (%v)", rx, err)
+	}
+	if id, err := fs.GetSystemUUID(); err != nil || id != "4c4c4544-0042" {
+		t.Errorf("expected the machine uuid, got %q (%v)", id, err)
+	}
+	if _, ok := newHostSysFs("/sys/").(*hostSysFs); ok {
+		t.Error("expected the real sysfs at /sys")
+	}
+}
@@ -0,0 +1,365 @@
+package cadvisor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	// defaultKubeletURL is the authenticated endpoint of the kubelet of the node
+	defaultKubeletURL = "https://localhost:10250"
+	// defaultKubeletTokenFile is the service account token of pods, used
+	// when it exists unless a token is configured
+	defaultKubeletTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// defaultKubeletTimeout bounds a request to the kubelet
+	defaultKubeletTimeout = 10 * time.Second
+	// kubeletPodContainer is the container the network and volumes of a pod
+	// are reported on, like cAdvisor reports them on the pause container
+	kubeletPodContainer = "POD"
+)
+
+// errKubeletMissing is why the families the summary API does not report are disabled
+var errKubeletMissing = errors.New("not reported by the kubelet summary API")
+
+// kubeletOptions configures the kubelet source
+type kubeletOptions struct {
+	url       string
+	token     string
+	tokenFile string
+	caFile    string
+	certFile  string
+	keyFile   string
+	insecure  bool
+	timeout   time.Duration
+}
+
+// kubeletOptionsOf reads the kubelet options set in cfg
+func kubeletOptionsOf(cfg plugin.Config) kubeletOptions {
+	options := kubeletOptions{
+		url:       strings.TrimSuffix(getString(cfg, "kubelet_url", defaultKubeletURL), "/"),
+		token:     getString(cfg, "kubelet_token", ""),
+		tokenFile: getString(cfg, "kubelet_token_file", defaultKubeletTokenFile),
+		caFile:    getString(cfg, "kubelet_ca_file", ""),
+		certFile:  getString(cfg, "kubelet_cert_file", ""),
+		keyFile:   getString(cfg, "kubelet_key_file", ""),
+		insecure:  getBool(cfg, "kubelet_insecure_skip_verify", false),
+		timeout:   time.Duration(getInt(cfg, "kubelet_timeout", 0)) * time.Second,
+	}
+	if options.timeout <= 0 {
+		options.timeout = defaultKubeletTimeout
+	}
+	return options
+}
+
+// kubeletCapabilities disables the families the summary API does not report,
+// and the metrics of the other families it leaves out
+func kubeletCapabilities() *capabilities {
+	return &capabilities{
+		failed:   map[string]error{"cgroup_blkio": errKubeletMissing, "tcp": errKubeletMissing, "tcp6": errKubeletMissing},
+		disabled: map[string]string{"diskio": "cgroup_blkio", "tcp": "tcp", "tcp6": "tcp6"},
+		unreported: map[string]bool{
+			"cpu/user/usage":    true,
+			"cpu/system/usage":  true,
+			"cpu/load":          true,
+			"mem/cache":         true,
+			"mem/swap":          true,
+			"mem/failcnt":       true,
+			"iface/in_packets":  true,
+			"iface/in_dropped":  true,
+			"iface/out_packets": true,
+			"iface/out_dropped": true,
+		},
+	}
+}
+
+// kubeletSource polls the /stats/summary endpoint of the kubelet, which
+// already collects the containers of its node, instead of running cAdvisor
+// in the plugin. The kubelet only serves the latest sample of every container.
+type kubeletSource struct {
+	options kubeletOptions
+	client  *http.Client
+}
+
+func newKubeletSource(options kubeletOptions) (*kubeletSource, error) {
+	u, err := url.Parse(options.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubelet_url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid kubelet_url %q, expected an http or https URL", options.url)
+	}
+	if (options.certFile == "") != (options.keyFile == "") {
+		return nil, fmt.Errorf("kubelet_cert_file and kubelet_key_file must be set together")
+	}
+	return &kubeletSource{options: options}, nil
+}
+
+// Start loads the certificates the kubelet is reached with
+func (k *kubeletSource) Start() error {
+	config := &tls.Config{InsecureSkipVerify: k.options.insecure}
+	if k.options.caFile != "" {
+		ca, err := ioutil.ReadFile(k.options.caFile)
+		if err != nil {
+			return fmt.Errorf("unable to read kubelet_ca_file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate found in kubelet_ca_file %s", k.options.caFile)
+		}
+	}
+	if k.options.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(k.options.certFile, k.options.keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load the kubelet client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	k.client = &http.Client{
+		Timeout:   k.options.timeout,
+		Transport: &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment},
+	}
+	return nil
+}
+
+// bearer returns the token to authenticate with. The token file is read on
+// every request since service account tokens are rotated, the default one
+// is only used when it exists.
+func (k *kubeletSource) bearer() (string, error) {
+	if k.options.token != "" {
+		return k.options.token, nil
+	}
+	if k.options.tokenFile == "" {
+		return "", nil
+	}
+	token, err := ioutil.ReadFile(k.options.tokenFile)
+	if os.IsNotExist(err) && k.options.tokenFile == defaultKubeletTokenFile {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read kubelet_token_file: %v", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// summary fetches the stats summary of the node
+func (k *kubeletSource) summary() (*kubeletSummary, error) {
+	if k.client == nil {
+		return nil, fmt.Errorf("kubelet source is not started")
+	}
+	req, err := http.NewRequest("GET", k.options.url+"/stats/summary", nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := k.bearer()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("kubelet responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	summary := &kubeletSummary{}
+	if err := json.NewDecoder(resp.Body).Decode(summary); err != nil {
+		return nil, fmt.Errorf("invalid kubelet summary: %v", err)
+	}
+	return summary, nil
+}
+
+// GetContainerInfoV2 returns the latest sample of every container of the
+// node, the pod network and volumes are reported on the POD container
+func (k *kubeletSource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	summary, err := k.summary()
+	if err != nil {
+		return nil, err
+	}
+	containers := map[string]info.ContainerInfo{}
+	for _, pod := range summary.Pods {
+		for _, cont := range pod.Containers {
+			containers[pod.containerName(cont.Name)] = cont.info(pod)
+		}
+		if cont, ok := pod.info(); ok {
+			containers[pod.containerName(kubeletPodContainer)] = cont
+		}
+	}
+	return containers, nil
+}
+
+// kubeletSummary is the part of the stats summary of the kubelet the
+// kubelet source converts
+type kubeletSummary struct {
+	Pods []kubeletPod `json:"pods"`
+}
+
+type kubeletPod struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Containers []kubeletContainer `json:"containers"`
+	Network    *kubeletNetwork    `json:"network"`
+	Volumes    []kubeletFs        `json:"volume"`
+}
+
+type kubeletContainer struct {
+	Name   string         `json:"name"`
+	CPU    *kubeletCPU    `json:"cpu"`
+	Memory *kubeletMemory `json:"memory"`
+	Rootfs *kubeletFs     `json:"rootfs"`
+	Logs   *kubeletFs     `json:"logs"`
+}
+
+type kubeletCPU struct {
+	Time                 time.Time `json:"time"`
+	UsageCoreNanoSeconds *uint64   `json:"usageCoreNanoSeconds"`
+}
+
+type kubeletMemory struct {
+	Time            time.Time `json:"time"`
+	UsageBytes      *uint64   `json:"usageBytes"`
+	WorkingSetBytes *uint64   `json:"workingSetBytes"`
+	RSSBytes        *uint64   `json:"rssBytes"`
+}
+
+type kubeletFs struct {
+	Time       time.Time `json:"time"`
+	UsedBytes  *uint64   `json:"usedBytes"`
+	InodesUsed *uint64   `json:"inodesUsed"`
+}
+
+type kubeletInterface struct {
+	Name     string  `json:"name"`
+	RxBytes  *uint64 `json:"rxBytes"`
+	RxErrors *uint64 `json:"rxErrors"`
+	TxBytes  *uint64 `json:"txBytes"`
+	TxErrors *uint64 `json:"txErrors"`
+}
+
+// kubeletNetwork holds the stats of the default interface of a pod, along
+// with every interface on kubelets that report them
+type kubeletNetwork struct {
+	Time time.Time `json:"time"`
+	kubeletInterface
+	Interfaces []kubeletInterface `json:"interfaces"`
+}
+
+// containerName returns the name the container of the pod is collected as
+func (p kubeletPod) containerName(container string) string {
+	return fmt.Sprintf("/kubelet/%s/%s/%s", p.PodRef.Namespace, p.PodRef.Name, container)
+}
+
+// spec returns the spec of the named container of the pod
+func (p kubeletPod) spec(container string) info.ContainerSpec {
+	return info.ContainerSpec{
+		Labels: map[string]string{
+			KubernetesPodNamespaceLabel:  p.PodRef.Namespace,
+			KubernetesPodNameLabel:       p.PodRef.Name,
+			KubernetesContainerNameLabel: container,
+		},
+	}
+}
+
+// info returns the POD container holding the network and volumes of the
+// pod, if it has any
+func (p kubeletPod) info() (info.ContainerInfo, bool) {
+	if p.Network == nil && len(p.Volumes) == 0 {
+		return info.ContainerInfo{}, false
+	}
+	spec := p.spec(kubeletPodContainer)
+	stats := &info.ContainerStats{}
+	if p.Network != nil {
+		spec.HasNetwork = true
+		stats.Timestamp = p.Network.Time
+		interfaces := p.Network.Interfaces
+		if len(interfaces) == 0 {
+			interfaces = []kubeletInterface{p.Network.kubeletInterface}
+		}
+		stats.Network = &info.NetworkStats{}
+		for _, i := range interfaces {
+			stats.Network.Interfaces = append(stats.Network.Interfaces, v1.InterfaceStats{
+				Name:     i.Name,
+				RxBytes:  summaryValue(i.RxBytes),
+				RxErrors: summaryValue(i.RxErrors),
+				TxBytes:  summaryValue(i.TxBytes),
+				TxErrors: summaryValue(i.TxErrors),
+			})
+		}
+	}
+	if len(p.Volumes) > 0 {
+		spec.HasFilesystem = true
+		var used, inodes uint64
+		for _, v := range p.Volumes {
+			used += summaryValue(v.UsedBytes)
+			inodes += summaryValue(v.InodesUsed)
+			stats.Timestamp = laterOf(stats.Timestamp, v.Time)
+		}
+		stats.Filesystem = &info.FilesystemStats{TotalUsageBytes: &used, InodeUsage: &inodes}
+	}
+	return info.ContainerInfo{Spec: spec, Stats: []*info.ContainerStats{stats}}, true
+}
+
+// info converts the container of pod, its filesystem usage is the one of its
+// writable layer and logs like the kubelet accounts for ephemeral storage
+func (c kubeletContainer) info(pod kubeletPod) info.ContainerInfo {
+	spec := pod.spec(c.Name)
+	stats := &info.ContainerStats{}
+	if c.CPU != nil && c.CPU.UsageCoreNanoSeconds != nil {
+		spec.HasCpu = true
+		stats.Timestamp = c.CPU.Time
+		stats.Cpu = &v1.CpuStats{Usage: v1.CpuUsage{Total: *c.CPU.UsageCoreNanoSeconds}}
+	}
+	if c.Memory != nil {
+		spec.HasMemory = true
+		stats.Timestamp = laterOf(stats.Timestamp, c.Memory.Time)
+		stats.Memory = &v1.MemoryStats{
+			Usage:      summaryValue(c.Memory.UsageBytes),
+			WorkingSet: summaryValue(c.Memory.WorkingSetBytes),
+			RSS:        summaryValue(c.Memory.RSSBytes),
+		}
+	}
+	if c.Rootfs != nil {
+		spec.HasFilesystem = true
+		stats.Timestamp = laterOf(stats.Timestamp, c.Rootfs.Time)
+		total := summaryValue(c.Rootfs.UsedBytes)
+		if c.Logs != nil {
+			total += summaryValue(c.Logs.UsedBytes)
+		}
+		stats.Filesystem = &info.FilesystemStats{TotalUsageBytes: &total, BaseUsageBytes: c.Rootfs.UsedBytes, InodeUsage: c.Rootfs.InodesUsed}
+	}
+	return info.ContainerInfo{Spec: spec, Stats: []*info.ContainerStats{stats}}
+}
+
+// summaryValue returns the value of an optional summary field, 0 when it is missing
+func summaryValue(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
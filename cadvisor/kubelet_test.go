@@ -0,0 +1,234 @@
+package cadvisor
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// kubeletStub serves the recorded summary of testdata/kubelet to requests
+// bearing token over TLS
+func kubeletStub(t *testing.T, token string) *httptest.Server {
+	summary, err := ioutil.ReadFile(filepath.Join("testdata", "kubelet", "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/stats/summary" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(summary)
+	}))
+}
+
+// writeCA writes the certificate of server to a PEM file in dir
+func writeCA(t *testing.T, server *httptest.Server, dir string) string {
+	path := filepath.Join(dir, "ca.crt")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKubeletSource(t *testing.T) {
+	server := kubeletStub(t, "secret")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "kubelet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := newKubeletSource(kubeletOptionsOf(plugin.Config{
+		"kubelet_url":        server.URL + "/",
+		"kubelet_token_file": tokenFile,
+		"kubelet_ca_file":    writeCA(t, server, dir),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Start(); err != nil {
+		t.Fatal(err)
+	}
+	containers, err := source.GetContainerInfoV2("/", info.RequestOptions{Count: 1, Recursive: true, IdType: info.TypeName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 4 {
+		t.Fatalf("expected 3 containers and the POD container of the web pod, got %d", len(containers))
+	}
+
+	nginx := containers["/kubelet/default/web-6d4cf56db6-x2x8k/nginx"]
+	if nginx.Spec.Labels[KubernetesContainerNameLabel] != "nginx" || !nginx.Spec.HasCpu || !nginx.Spec.HasMemory || !nginx.Spec.HasFilesystem || nginx.Spec.HasNetwork {
+		t.Errorf("unexpected nginx spec %+v", nginx.Spec)
+	}
+	s := nginx.Stats[0]
+	if s.Cpu.Usage.Total != 123456789000 || s.Memory.WorkingSet != 16777216 || s.Memory.RSS != 8388608 {
+		t.Errorf("unexpected nginx stats %+v %+v", s.Cpu, s.Memory)
+	}
+	if *s.Filesystem.TotalUsageBytes != 40960+8192 || *s.Filesystem.BaseUsageBytes != 40960 || *s.Filesystem.InodeUsage != 12 {
+		t.Errorf("expected the rootfs and logs usage, got %+v", s.Filesystem)
+	}
+	if s.Timestamp.Unix() != 1500000001 {
+		t.Errorf("expected the latest time of the container stats, got %v", s.Timestamp)
+	}
+
+	pod := containers["/kubelet/default/web-6d4cf56db6-x2x8k/POD"]
+	if !pod.Spec.HasNetwork || !pod.Spec.HasFilesystem || pod.Spec.HasCpu {
+		t.Errorf("unexpected POD spec %+v", pod.Spec)
+	}
+	if i := pod.Stats[0].Network.Interfaces; len(i) != 2 || i[1].Name != "eth1" || i[1].TxBytes != 400 || i[0].RxErrors != 1 {
+		t.Errorf("unexpected POD interfaces %+v", i)
+	}
+	if fs := pod.Stats[0].Filesystem; *fs.TotalUsageBytes != 4096+1048576 || *fs.InodeUsage != 110 || fs.BaseUsageBytes != nil {
+		t.Errorf("expected the volume usage on the POD container, got %+v", fs)
+	}
+
+	// containers without cpu usage yet are not reported as idle
+	if worker := containers["/kubelet/batch/job-abcde/worker"]; worker.Spec.HasCpu || !worker.Spec.HasMemory {
+		t.Errorf("unexpected worker spec %+v", worker.Spec)
+	}
+}
+
+func TestKubeletSourceErrors(t *testing.T) {
+	server := kubeletStub(t, "secret")
+	defer server.Close()
+
+	for _, c := range []struct {
+		name  string
+		cfg   plugin.Config
+		error string
+	}{
+		{"unknown certificate", plugin.Config{"kubelet_url": server.URL, "kubelet_token": "secret"}, "certificate"},
+		{"wrong token", plugin.Config{"kubelet_url": server.URL, "kubelet_token": "wrong", "kubelet_insecure_skip_verify": true}, "401 Unauthorized"},
+		{"missing token file", plugin.Config{"kubelet_url": server.URL, "kubelet_token_file": "/nonexistent/token", "kubelet_insecure_skip_verify": true}, "kubelet_token_file"},
+	} {
+		source, err := newKubeletSource(kubeletOptionsOf(c.cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := source.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := source.GetContainerInfoV2("/", info.RequestOptions{Count: 1, Recursive: true, IdType: info.TypeName}); err == nil || !strings.Contains(err.Error(), c.error) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", c.name, c.error, err)
+		}
+	}
+
+	if _, err := newKubeletSource(kubeletOptionsOf(plugin.Config{"kubelet_url": "localhost:10250"})); err == nil {
+		t.Error("expected an error for a kubelet_url without scheme")
+	}
+	if _, err := newKubeletSource(kubeletOptionsOf(plugin.Config{"kubelet_cert_file": "client.crt"})); err == nil {
+		t.Error("expected an error for a client certificate without key")
+	}
+	source, _ := newKubeletSource(kubeletOptionsOf(plugin.Config{"kubelet_ca_file": "/nonexistent/ca.crt"}))
+	if err := source.Start(); err == nil {
+		t.Error("expected an error for a missing kubelet_ca_file")
+	}
+}
+
+func TestKubeletSourceCollected(t *testing.T) {
+	server := kubeletStub(t, "secret")
+	defer server.Close()
+
+	cfg := plugin.Config{
+		"interval":                     int64(15),
+		"source":                       sourceKubelet,
+		"kubelet_url":                  server.URL,
+		"kubelet_token":                "secret",
+		"kubelet_insecure_skip_verify": true,
+	}
+	c := NewCollector()
+	catalog, err := c.GetMetricTypes(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreported := kubeletCapabilities().unreported
+	for _, m := range catalog {
+		if met, ok := lookupMetric(m.Namespace); ok && (met.Family == "diskio" || met.Family == "tcp" || met.Family == "tcp6" || unreported[met.id()]) {
+			t.Errorf("%s is not reported by the kubelet and should not be advertised", m.Namespace.String())
+		}
+	}
+	config := newSnapshot(requestAll(cfg))
+	if err := c.ensureSource(config); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{}
+	for _, m := range c.collect(config) {
+		values[m.Namespace.String()] = m.Data
+	}
+	prefix := "/" + PluginVendor + "/" + PluginName + "/container/default/web-6d4cf56db6-x2x8k/"
+	for name, expected := range map[string]interface{}{
+		"nginx/mem/working_set":   uint64(16777216),
+		"nginx/cpu/total/usage":   uint64(123456789000),
+		"POD/iface/eth1/in_bytes": uint64(300),
+		"POD/fs/total_usage":      uint64(4096 + 1048576),
+	} {
+		if values[prefix+name] != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, values[prefix+name])
+		}
+	}
+	for name := range values {
+		if strings.Contains(name, "/tcp/") || strings.Contains(name, "/diskio/") {
+			t.Errorf("unexpected metric %s", name)
+		}
+	}
+	// the metrics the summary leaves out are not emitted as 0
+	for _, name := range []string{
+		"nginx/cpu/user/usage",
+		"nginx/cpu/system/usage",
+		"nginx/cpu/load",
+		"nginx/mem/cache",
+		"nginx/mem/swap",
+		"nginx/mem/failcnt",
+		"POD/iface/eth1/in_packets",
+		"POD/iface/eth1/in_dropped",
+		"POD/iface/eth1/out_packets",
+		"POD/iface/eth1/out_dropped",
+	} {
+		if v, ok := values[prefix+name]; ok {
+			t.Errorf("%s is not reported by the kubelet, got %v", name, v)
+		}
+	}
+	if _, ok := values[prefix+"POD/iface/eth1/in_errors"]; !ok {
+		t.Error("expected the interface errors the kubelet reports")
+	}
+}
+
+func TestKubeletUnreportedMetrics(t *testing.T) {
+	ids := map[string]bool{}
+	for _, m := range registry {
+		ids[m.id()] = true
+	}
+	for id := range kubeletCapabilities().unreported {
+		if !ids[id] {
+			t.Errorf("%s is not a registry metric", id)
+		}
+	}
+	// metrics named as in older schema versions are left out as well
+	caps := kubeletCapabilities()
+	for _, m := range registryFor(schemaV1) {
+		if m.Family == "iface" && strings.HasSuffix(m.Path[0], "_packets") && caps.reports(m) {
+			t.Errorf("%s/%s is not reported by the kubelet", m.Family, strings.Join(m.Path, "/"))
+		}
+	}
+}
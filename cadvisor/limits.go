@@ -0,0 +1,199 @@
+package cadvisor
+
+import (
+	"log"
+	"sort"
+
+	info "github.com/google/cadvisor/info/v2"
+)
+
+// Limit policies selectable through the "limit_policy" config
+const (
+	// policySorted keeps the containers and devices that come first by name
+	policySorted = "sorted"
+	// policyUsage keeps the containers with the largest working set and the
+	// devices that transferred the most bytes
+	policyUsage = "usage"
+)
+
+// limits bound the number of series of an emission, zero limits are unbounded
+type limits struct {
+	// series is the maximum number of container series per emission
+	series int
+	// devices is the maximum number of devices per family and container
+	devices int
+	policy  string
+}
+
+// policyOf returns the limit policy set in the task config
+func policyOf(policy string) string {
+	switch policy {
+	case policySorted, policyUsage:
+		return policy
+	default:
+		log.Printf("unknown limit policy %q, using %q\n", policy, policySorted)
+		return policySorted
+	}
+}
+
+// deviceUsage names the metrics of a family summed up to rank its devices by usage
+var deviceUsage = map[string][]string{
+	"iface":  {"in_bytes", "out_bytes"},
+	"diskio": {"read_bytes", "write_bytes"},
+}
+
+// containerDevices decides how the devices of a container are named and
+// which of them are emitted: disks are named by resolver, devices filters do
+// not collect are skipped and so are the devices the policy dropped, whose
+// series are counted once per collection in dropped
+type containerDevices struct {
+	resolver *deviceResolver
+	filters  *deviceFilters
+	kept     map[string]map[string]bool
+	dropped  map[string]bool
+}
+
+// devicesOf selects the devices of every per device family of metrics kept
+// for a container, ranked on its latest sample s among the devices filters
+// collect
+func (l limits) devicesOf(resolver *deviceResolver, filters *deviceFilters, metrics []*Metric, s *info.ContainerStats) *containerDevices {
+	devices := &containerDevices{resolver: resolver, filters: filters}
+	if l.devices <= 0 {
+		return devices
+	}
+	families := map[string]bool{}
+	for _, m := range metrics {
+		if m.PerDevice() {
+			families[m.Family] = true
+		}
+	}
+	devices.kept = map[string]map[string]bool{}
+	for family := range families {
+		names, usage := devices.family(family, s)
+		if len(names) <= l.devices {
+			continue
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := names[i], names[j]
+			if l.policy == policyUsage && usage[a] != usage[b] {
+				return usage[a] > usage[b]
+			}
+			return a < b
+		})
+		kept := make(map[string]bool, l.devices)
+		for _, name := range names[:l.devices] {
+			kept[name] = true
+		}
+		devices.kept[family] = kept
+	}
+	return devices
+}
+
+// family lists the names of the devices of a family found in s that filters
+// collect, with their usage
+func (c *containerDevices) family(family string, s *info.ContainerStats) ([]string, map[string]float64) {
+	names := []string{}
+	usage := map[string]float64{}
+	for _, m := range registry {
+		// derived metrics are found on devices the raw ones list already
+		if m.Family != family || m.Devices == nil {
+			continue
+		}
+		counts := false
+		for _, key := range deviceUsage[family] {
+			counts = counts || key == m.Key()
+		}
+		m.Devices(s, func(d Device, v interface{}) {
+			d = c.resolve(family, d)
+			if !c.collects(family, d) {
+				return
+			}
+			if _, ok := usage[d.Name]; !ok {
+				names = append(names, d.Name)
+				usage[d.Name] = 0
+			}
+			if f, ok := toFloat(v); ok && counts {
+				usage[d.Name] += f
+			}
+		})
+	}
+	return names, usage
+}
+
+// resolve names device d of family, only disks are renamed
+func (c *containerDevices) resolve(family string, d Device) Device {
+	if c == nil || c.resolver == nil || family != "diskio" {
+		return d
+	}
+	d.Name = c.resolver.name(d)
+	return d
+}
+
+// allows reports whether device d of metric m is collected and kept
+func (c *containerDevices) allows(m *Metric, d Device) bool {
+	return c.collects(m.Family, d) && !c.drops(m.Family, d.Name, m.id())
+}
+
+// collects reports whether filters collect device d of family
+func (c *containerDevices) collects(family string, d Device) bool {
+	return c == nil || c.filters.allows(family, d)
+}
+
+// drops reports whether the policy dropped the named device of family,
+// counting the series of metric name on it. Every sample of a collection
+// asks for the same series, so each is counted once.
+func (c *containerDevices) drops(family, device, name string) bool {
+	if c == nil {
+		return false
+	}
+	if kept, ok := c.kept[family]; !ok || kept[device] {
+		return false
+	}
+	if c.dropped == nil {
+		c.dropped = map[string]bool{}
+	}
+	c.dropped[name+"@"+device] = true
+	return true
+}
+
+// keepContainers selects the containers whose series fit into the series
+// limit. Containers are kept whole in policy order until the next one does
+// not fit, sizes holds the number of series of every container of names.
+func (l limits) keepContainers(names []string, containers map[string]info.ContainerInfo, sizes []int) []bool {
+	kept := make([]bool, len(names))
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	if l.policy == policyUsage {
+		usage := make([]uint64, len(names))
+		for i, name := range names {
+			usage[i] = workingSet(containers[name])
+		}
+		// names are sorted, so ties stay in name order
+		sort.SliceStable(order, func(i, j int) bool { return usage[order[i]] > usage[order[j]] })
+	}
+	total := 0
+	for _, i := range order {
+		if total+sizes[i] > l.series {
+			break
+		}
+		total += sizes[i]
+		kept[i] = true
+	}
+	return kept
+}
+
+// workingSet returns the working set of the latest sample of a container
+func workingSet(cont info.ContainerInfo) uint64 {
+	var latest *info.ContainerStats
+	for _, s := range cont.Stats {
+		if latest == nil || s.Timestamp.After(latest.Timestamp) {
+			latest = s
+		}
+	}
+	if latest == nil || latest.Memory == nil {
+		return 0
+	}
+	return latest.Memory.WorkingSet
+}
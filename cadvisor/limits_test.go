@@ -0,0 +1,167 @@
+package cadvisor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// ifaceStats returns a sample with the given received bytes per interface
+func ifaceStats(rx map[string]uint64) *info.ContainerStats {
+	s := testStats()
+	s.Network.Interfaces = nil
+	for name, bytes := range rx {
+		s.Network.Interfaces = append(s.Network.Interfaces, v1.InterfaceStats{Name: name, RxBytes: bytes})
+	}
+	return s
+}
+
+func TestDeviceLimit(t *testing.T) {
+	s := ifaceStats(map[string]uint64{"veth2": 300, "veth0": 10, "veth1": 200, "eth0": 5})
+	requested := []*Metric{}
+	for _, m := range registry {
+		if m.Family == "iface" {
+			requested = append(requested, m)
+		}
+	}
+	for _, tc := range []struct {
+		policy string
+		kept   []string
+	}{
+		{policy: policySorted, kept: []string{"eth0", "veth0"}},
+		{policy: policyUsage, kept: []string{"veth1", "veth2"}},
+	} {
+		devices := limits{devices: 2, policy: tc.policy}.devicesOf(nil, nil, requested, s)
+		metrics := []plugin.Metric{}
+		for _, m := range requested {
+			metrics = m.convert(metrics, newContainerSeries([3]string{"ns", "pod", "cont"}, schemeSnap), nil, s, devices)
+		}
+		names := map[string]bool{}
+		for _, m := range metrics {
+			names[m.Namespace.Element(familyIndex+1).Value] = true
+		}
+		if len(names) != 2 || !names[tc.kept[0]] || !names[tc.kept[1]] {
+			t.Errorf("%s: expected %v to be kept, got %v", tc.policy, tc.kept, names)
+		}
+		if len(devices.dropped) != 2*len(requested) {
+			t.Errorf("%s: expected %d dropped series, got %d", tc.policy, 2*len(requested), len(devices.dropped))
+		}
+	}
+	if devices := (limits{devices: 4}).devicesOf(nil, nil, requested, s); len(devices.kept) != 0 {
+		t.Error("expected every device to be kept when they fit")
+	}
+}
+
+func TestDeviceLimitCountsSeriesOnce(t *testing.T) {
+	samples := []*info.ContainerStats{}
+	for _, sec := range []int64{10, 20, 30} {
+		s := ifaceStats(map[string]uint64{"eth0": uint64(sec), "veth0": uint64(2 * sec)})
+		s.Timestamp = time.Unix(sec, 0)
+		samples = append(samples, s)
+	}
+	c := NewCollector()
+	source := &fakeSource{stats: samples[:1]}
+	c.mng = source
+	in := plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "iface", "*", "in_bytes")
+	requested := requestedMetrics(15, in, in.AddStaticElement("max"))
+	for i := range requested {
+		requested[i].Config = plugin.Config{"max_devices": int64(1), "high_resolution": true, "stats": "iface:max"}
+	}
+	config := newSnapshot(requested)
+	// a new container only emits its latest sample
+	c.collect(config)
+	first := c.stats.droppedSeries
+	source.stats = samples
+	if metrics := c.collect(config); len(metrics) != 3 {
+		t.Fatalf("expected both fresh samples and the summary of eth0, got %d metrics", len(metrics))
+	}
+	// the in_bytes series of veth0 and its summary, whatever the number of samples
+	if first != 2 || c.stats.droppedSeries-first != 2 {
+		t.Errorf("expected 2 dropped series per collection, got %d and %d", first, c.stats.droppedSeries-first)
+	}
+}
+
+// limitSource serves three containers, with working sets growing in name order
+func limitSource() *fakeSource {
+	container := func(name string, workingSet uint64) info.ContainerInfo {
+		s := statsAt(10)
+		s[0].Memory.WorkingSet = workingSet
+		return info.ContainerInfo{
+			Spec: info.ContainerSpec{
+				Labels: map[string]string{
+					KubernetesPodNameLabel:       name,
+					KubernetesPodNamespaceLabel:  "ns",
+					KubernetesContainerNameLabel: "cont",
+				},
+				HasMemory: true,
+			},
+			Stats: s,
+		}
+	}
+	return &fakeSource{stats: statsAt(10), extra: map[string]info.ContainerInfo{
+		"/kubepods/pod2/cont": container("pod2", 500),
+		"/kubepods/pod3/cont": container("pod3", 1000),
+	}}
+}
+
+func TestSeriesLimit(t *testing.T) {
+	mem := plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "working_set")
+	for _, tc := range []struct {
+		policy string
+		pods   []string
+	}{
+		{policy: policySorted, pods: []string{"pod", "pod2"}},
+		{policy: policyUsage, pods: []string{"pod3", "pod2"}},
+	} {
+		c := NewCollector()
+		c.mng = limitSource()
+		requested := requestedMetrics(15, mem)
+		requested[0].Config = plugin.Config{"max_series": int64(2), "limit_policy": tc.policy}
+		metrics := c.collect(newSnapshot(requested))
+		if len(metrics) != 2 {
+			t.Fatalf("%s: expected 2 series, got %d", tc.policy, len(metrics))
+		}
+		pods := map[string]bool{}
+		for _, m := range metrics {
+			pods[m.Namespace.Element(4).Value] = true
+		}
+		if !pods[tc.pods[0]] || !pods[tc.pods[1]] {
+			t.Errorf("%s: expected %v to be kept, got %v", tc.policy, tc.pods, pods)
+		}
+		if c.stats.droppedSeries != 1 {
+			t.Errorf("%s: expected 1 dropped series, got %d", tc.policy, c.stats.droppedSeries)
+		}
+	}
+}
+
+func TestSeriesLimitWarning(t *testing.T) {
+	c := NewCollector()
+	c.mng = limitSource()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mtxIn := make(chan []plugin.Metric)
+	mtxOut := make(chan []plugin.Metric)
+	chanErr := make(chan string, 1)
+	go c.StreamMetrics(ctx, mtxIn, mtxOut, chanErr)
+
+	<-mtxOut
+	requested := requestedMetrics(3600, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "working_set"))
+	requested[0].Config = plugin.Config{"interval": int64(3600), "max_series": int64(1)}
+	mtxIn <- requested
+	select {
+	case warning := <-chanErr:
+		if !strings.Contains(warning, "dropped 2 series") {
+			t.Errorf("unexpected warning %q", warning)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no warning sent when the series limit was hit")
+	}
+	if metrics := <-mtxOut; len(metrics) != 1 {
+		t.Errorf("expected 1 series, got %d", len(metrics))
+	}
+}
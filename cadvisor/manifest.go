@@ -10,63 +10,90 @@ import (
 // Manifest maintains a list of metrics that must be gathered
 // by the colllector
 type Manifest struct {
-	tcpMetrics    []string
-	tcp6Metrics   []string
-	cpuMetrics    []string
-	loadMetrics   []string
-	ifaceMetrics  []string
-	fsMetrics     []string
-	diskIoMetrics []string
-	memMetrics    []string
+	metrics []*Metric
+	stats   []statRequest
+	self    []*SelfMetric
+}
+
+// disable drops the metrics and summaries caps cannot collect
+func (m *Manifest) disable(caps *capabilities) {
+	metrics := m.metrics[:0]
+	for _, met := range m.metrics {
+		if caps.reports(met) {
+			metrics = append(metrics, met)
+		}
+	}
+	m.metrics = metrics
+	stats := m.stats[:0]
+	for _, stat := range m.stats {
+		if caps.reports(stat.metric) {
+			stats = append(stats, stat)
+		}
+	}
+	m.stats = stats
 }
 
 func (m *Manifest) buildMetricsList(metrics []plugin.Metric) time.Duration {
-	m.tcpMetrics = []string{}
-	m.tcp6Metrics = []string{}
-	m.cpuMetrics = []string{}
-	m.loadMetrics = []string{}
-	m.ifaceMetrics = []string{}
-	m.fsMetrics = []string{}
-	m.memMetrics = []string{}
-	m.diskIoMetrics = []string{}
+	m.metrics = []*Metric{}
+	m.stats = []statRequest{}
+	m.self = []*SelfMetric{}
+	if len(metrics) == 0 {
+		return defaultInterval
+	}
 	intervalVal, err := metrics[0].Config.GetInt("interval")
 	var interval time.Duration
 	if err != nil {
-		interval = time.Second * 15
+		interval = defaultInterval
 	} else {
 		interval = time.Second * time.Duration(intervalVal)
 	}
+	// metrics are named as in the schema version of the task, whatever the
+	// version of the names they were requested with
+	version := schemaOf(metrics[0].Config)
+	requested := map[interface{}]bool{}
 	for _, mtx := range metrics {
-		if mtx.Namespace.Element(6).Value == "tcp" {
-			m.tcpMetrics = append(m.tcpMetrics, mtx.Namespace.Element(7).Value)
-			continue
-		}
-		if mtx.Namespace.Element(6).Value == "tcp6" {
-			m.tcp6Metrics = append(m.tcp6Metrics, mtx.Namespace.Element(7).Value)
-			continue
-		}
-		if mtx.Namespace.Element(6).Value == "cpu" {
-			m.cpuMetrics = append(m.cpuMetrics, mtx.Namespace.Element(7).Value)
-			continue
-		}
-		if mtx.Namespace.Element(6).Value == "load" {
-			m.loadMetrics = append(m.loadMetrics, mtx.Namespace.Element(7).Value)
+		ns := canonical(mtx.Namespace)
+		if met, ok := lookupMetric(ns); ok {
+			met = versioned(met, version)
+			if !requested[met] {
+				requested[met] = true
+				m.metrics = append(m.metrics, met)
+			}
 			continue
 		}
-		if mtx.Namespace.Element(6).Value == "iface" {
-			m.ifaceMetrics = append(m.ifaceMetrics, mtx.Namespace.Element(8).Value)
+		if compat := lookupCompat(ns); len(compat) > 0 {
+			for _, met := range compat {
+				met = versioned(met, version)
+				if !requested[met] {
+					requested[met] = true
+					m.metrics = append(m.metrics, met)
+				}
+			}
 			continue
 		}
-		if mtx.Namespace.Element(6).Value == "fs" {
-			m.fsMetrics = append(m.fsMetrics, mtx.Namespace.Element(7).Value)
+		if compat := lookupCompatStats(ns); len(compat) > 0 {
+			for _, stat := range compat {
+				stat.metric = versioned(stat.metric, version)
+				if !requested[stat] {
+					requested[stat] = true
+					m.stats = append(m.stats, stat)
+				}
+			}
 			continue
 		}
-		if mtx.Namespace.Element(6).Value == "mem" {
-			m.memMetrics = append(m.memMetrics, mtx.Namespace.Element(7).Value)
+		if stat, ok := lookupStat(ns); ok {
+			stat.metric = versioned(stat.metric, version)
+			if !requested[stat] {
+				requested[stat] = true
+				m.stats = append(m.stats, stat)
+			}
 			continue
 		}
-		if mtx.Namespace.Element(6).Value == "diskio" {
-			m.diskIoMetrics = append(m.diskIoMetrics, mtx.Namespace.Element(8).Value)
+		if met, ok := lookupSelfMetric(mtx.Namespace); ok {
+			if !requested[met] {
+				requested[met] = true
+				m.self = append(m.self, met)
+			}
 			continue
 		}
 		log.Printf("metric %v not found but requested\n", mtx.Namespace.String())
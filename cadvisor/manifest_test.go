@@ -12,13 +12,53 @@ var (
 			Namespace: plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "tcp", "ESTABLISHED"),
 		},
 	}
+	metricList2 = []plugin.Metric{
+		plugin.Metric{
+			Namespace: plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "read_bytes"),
+		},
+		plugin.Metric{
+			Namespace: plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "cpu", "total", "usage"),
+		},
+		plugin.Metric{
+			Namespace: plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "cpu", "total", "usage"),
+		},
+		plugin.Metric{
+			Namespace: plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "cpu", "unknown"),
+		},
+	}
 )
 
 func TestBuildMetricsList(t *testing.T) {
 	newManifest := Manifest{}
 	newManifest.buildMetricsList(metricList1)
-	if newManifest.tcpMetrics[0] != "ESTABLISHED" {
+	if len(newManifest.metrics) != 1 || newManifest.metrics[0].Family != "tcp" || newManifest.metrics[0].Key() != "ESTABLISHED" {
 		t.Errorf("ESTABLISHED not added to TCP Metrics")
 		t.Fail()
 	}
 }
+
+func TestBuildMetricsListDevicesAndDuplicates(t *testing.T) {
+	newManifest := Manifest{}
+	newManifest.buildMetricsList(metricList2)
+	if len(newManifest.metrics) != 2 {
+		t.Fatalf("expected 2 metrics in manifest, got %d", len(newManifest.metrics))
+	}
+	if newManifest.metrics[0].Family != "diskio" || newManifest.metrics[0].Key() != "read_bytes" {
+		t.Errorf("read_bytes not added to diskio Metrics")
+	}
+	if newManifest.metrics[1].Family != "cpu" || newManifest.metrics[1].Key() != "total" {
+		t.Errorf("total not added to cpu Metrics")
+	}
+}
+
+func TestBuildMetricsListSelfMetrics(t *testing.T) {
+	newManifest := Manifest{}
+	newManifest.buildMetricsList([]plugin.Metric{
+		plugin.Metric{
+			Namespace: plugin.NewNamespace(PluginVendor, PluginName, "plugin", "scheduler", "overruns"),
+		},
+	})
+	if len(newManifest.metrics) != 0 || len(newManifest.self) != 1 || newManifest.self[0] != selfRegistry[0] {
+		t.Errorf("overruns not added to self Metrics")
+	}
+}
@@ -1,713 +1,780 @@
 package cadvisor
 
 import (
+	"strings"
+	"time"
+
 	"github.com/google/cadvisor/info/v1"
 	info "github.com/google/cadvisor/info/v2"
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 )
 
-// Metric type to translate v2.ContainerInfo into a snap Metric
+// Kind describes how the value of a metric behaves over time
+type Kind int
+
+const (
+	// Gauge values can go up and down between samples
+	Gauge Kind = iota
+	// Counter values only ever increase over the lifetime of a container
+	Counter
+)
+
+// Capability is the container spec capability a metric needs in order to be collected
+type Capability int
+
+const (
+	// HasCpu requires cpu stats to be available for the container
+	HasCpu Capability = iota
+	// HasMemory requires memory stats to be available for the container
+	HasMemory
+	// HasNetwork requires network stats to be available for the container
+	HasNetwork
+	// HasFilesystem requires filesystem stats to be available for the container
+	HasFilesystem
+	// HasDiskIo requires diskio stats to be available for the container
+	HasDiskIo
+)
+
+// supported reports whether the container spec provides the capability
+func (c Capability) supported(spec info.ContainerSpec) bool {
+	switch c {
+	case HasCpu:
+		return spec.HasCpu
+	case HasMemory:
+		return spec.HasMemory
+	case HasNetwork:
+		return spec.HasNetwork
+	case HasFilesystem:
+		return spec.HasFilesystem
+	case HasDiskIo:
+		return spec.HasDiskIo
+	}
+	return false
+}
+
+// Device identifies the network interface or block device a value was read from
+type Device struct {
+	Name  string
+	Major uint64
+	Minor uint64
+}
+
+// DeviceExtractor calls emit once for every device value found in s
+type DeviceExtractor func(s *info.ContainerStats, emit func(d Device, v interface{}))
+
+// DeviceDeriver calls emit once for every device value derived between the
+// previous sample prev of a container and its sample s
+type DeviceDeriver func(prev, s *info.ContainerStats, emit func(d Device, v interface{}))
+
+// Compat describes the cAdvisor Prometheus exporter equivalent of a metric,
+// used by the cadvisor namespace scheme
+type Compat struct {
+	// Name of the exporter metric
+	Name string
+	// Labels distinguish metrics sharing the same Name
+	Labels map[string]string
+	// Device is the label holding the device name of per device metrics
+	Device string
+	// Unit and Scale convert values to the exporter unit, unset when it matches
+	Unit  string
+	Scale float64
+}
+
+// Metric declares a single metric of the plugin and how to translate
+// v2.ContainerStats into it. Container level metrics set Data, per device
+// metrics set Devices, or Derive when computed between samples, and the name
+// of the dynamic device element.
 type Metric struct {
-	Namespace   func(ns string, pn string, cn string) plugin.Namespace
-	Description string
-	Unit        string
-	Tags        map[string]string
-	Data        func(s *info.ContainerStats) interface{}
+	Family            string
+	Path              []string
+	DeviceName        string
+	DeviceDescription string
+	Unit              string
+	Description       string
+	Kind              Kind
+	Requires          Capability
+	Compat            Compat
+	Data              func(s *info.ContainerStats) interface{}
+	Devices           DeviceExtractor
+	Derive            DeviceDeriver
+	// origin is the registry metric a metric named in an older schema
+	// version was renamed from, nil for registry metrics
+	origin *Metric
 }
 
-// IfaceMetric type to translate v1.InterfaceStats into a snap Metric
-type IfaceMetric struct {
-	Namespace   func(ns string, pn string, cn string, name string) plugin.Namespace
-	Description string
-	Unit        string
-	Tags        map[string]string
-	Data        func(s v1.InterfaceStats) interface{}
+// Key is the name used to refer to the metric within its family
+func (m *Metric) Key() string {
+	return m.Path[0]
 }
 
-// DiskIoMetric type to translate v1.InterfaceStats into a snap Metric
-type DiskIoMetric struct {
-	Namespace   func(ns string, pn string, cn string, name string) plugin.Namespace
-	Description string
-	Unit        string
-	Tags        map[string]string
-	Data        func(s v1.PerDiskStats) interface{}
+// id identifies the metric by its family and path in the current schema
+// version, whatever version it is named in
+func (m *Metric) id() string {
+	if m.origin != nil {
+		m = m.origin
+	}
+	return m.Family + "/" + strings.Join(m.Path, "/")
 }
 
-func containerNamespace(ns string, pn string, cn string) plugin.Namespace {
-	return plugin.Namespace{
-		plugin.NamespaceElement{
-			Value: PluginVendor,
-		},
-		plugin.NamespaceElement{
-			Value: PluginName,
-		},
-		plugin.NamespaceElement{
-			Value: "container",
-		},
-		plugin.NamespaceElement{
-			Name:  "namespace",
-			Value: ns,
-		},
-		plugin.NamespaceElement{
-			Name:  "pod_name",
-			Value: pn,
-		},
-		plugin.NamespaceElement{
-			Name:  "container_name",
-			Value: cn,
-		},
+// PerDevice reports whether the metric is emitted once per device
+func (m *Metric) PerDevice() bool {
+	return m.Devices != nil || m.Derive != nil
+}
+
+// Namespace returns the namespace of the metric for the given container and device,
+// device is ignored for container level metrics
+func (m *Metric) Namespace(ns string, pn string, cn string, device string) plugin.Namespace {
+	metName := containerNamespace(ns, pn, cn).AddStaticElement(m.Family)
+	if m.PerDevice() {
+		metName = metName.AddDynamicElement(m.DeviceName, m.DeviceDescription)
+		if device != "*" {
+			metName[len(metName)-1].Value = device
+		}
 	}
+	return metName.AddStaticElements(m.Path...)
 }
 
-var (
-	cpuMap = map[string]Metric{
-		"total": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("cpu", "total", "usage")
-			},
-			Unit:        "ns",
-			Description: "total CPU usage",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Cpu.Usage.Total
-			},
-		},
-		"user": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("cpu", "user", "usage")
-			},
-			Unit:        "ns",
-			Description: "user CPU usage",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Cpu.Usage.User
-			},
-		},
-		"system": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("cpu", "system", "usage")
-			},
-			Unit:        "ns",
-			Description: "system CPU usage",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Cpu.Usage.System
-			},
-		},
-		"load": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("cpu", "load")
-			},
-			Unit:        "load",
-			Description: " Load is smoothed over the last 10 seconds. Instantaneous value can be read",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Cpu.LoadAverage
-			},
-		},
+// matches reports whether the requested namespace refers to the metric
+func (m *Metric) matches(ns plugin.Namespace) bool {
+	if len(ns) <= familyIndex || ns.Element(familyIndex).Value != m.Family {
+		return false
+	}
+	offset := familyIndex + 1
+	if m.PerDevice() {
+		offset++
+	}
+	if len(ns) != offset+len(m.Path) {
+		return false
+	}
+	for i, p := range m.Path {
+		if ns.Element(offset+i).Value != p {
+			return false
+		}
 	}
+	return true
+}
 
-	tcpMap = map[string]Metric{
-		"ESTABLISHED": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "ESTABLISHED")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'ESTABLISHED'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.Established
-			},
-		},
-		"SYN_SENT": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "SYN_SENT")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'SYN_SENT'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.SynSent
-			},
-		},
-		"SYN_RECV": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "SYN_RECV")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'SYN_RECV'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.SynRecv
-			},
-		},
-		"FIN_WAIT_1": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "FIN_WAIT_1")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'FIN_WAIT_1'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.FinWait1
-			},
-		},
-		"FIN_WAIT_2": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "FIN_WAIT_2")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'FIN_WAIT_2'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.FinWait2
-			},
-		},
-		"TIME_WAIT": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "TIME_WAIT")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'TIME_WAIT'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.TimeWait
-			},
-		},
-		"CLOSE": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "CLOSE")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'CLOSE'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.Close
-			},
-		},
-		"CLOSE_WAIT": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "CLOSE_WAIT")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'CLOSE_WAIT'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.CloseWait
-			},
-		},
-		"LAST_ACK": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "LAST_ACK")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'LAST_ACK'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.LastAck
-			},
-		},
-		"LISTEN": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "LISTEN")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'LISTEN'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.Listen
-			},
-		},
-		"CLOSING": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp", "CLOSING")
-			},
-			Unit:        "event",
-			Description: "Count of TCP connections in state 'CLOSING'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp.Closing
-			},
-		},
+// convert appends the values of the metric found in s to metrics, named after
+// the cached series of the container. Devices are named by devices and the
+// ones it does not emit are skipped before their series are built. Derived
+// metrics are computed from the previous sample prev, and skipped without it.
+func (m *Metric) convert(metrics []plugin.Metric, series *containerSeries, prev, s *info.ContainerStats, devices *containerDevices) []plugin.Metric {
+	if !m.PerDevice() {
+		data := m.Data(s)
+		if data == nil {
+			return metrics
+		}
+		return append(metrics, m.metric(series, Device{}, data, s.Timestamp))
 	}
+	m.values(prev, s, func(d Device, v interface{}) {
+		if d = devices.resolve(m.Family, d); devices.allows(m, d) {
+			metrics = append(metrics, m.metric(series, d, v, s.Timestamp))
+		}
+	})
+	return metrics
+}
 
-	tcp6Map = map[string]Metric{
-		"ESTABLISHED": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "ESTABLISHED")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'ESTABLISHED'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.Established
-			},
-		},
-		"SYN_SENT": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "SYN_SENT")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'SYN_SENT'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.SynSent
-			},
-		},
-		"SYN_RECV": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "SYN_RECV")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'SYN_RECV'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.SynRecv
-			},
-		},
-		"FIN_WAIT_1": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "FIN_WAIT_1")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'FIN_WAIT_1'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.FinWait1
-			},
-		},
-		"FIN_WAIT_2": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "FIN_WAIT_2")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'FIN_WAIT_2'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.FinWait2
-			},
-		},
-		"TIME_WAIT": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "TIME_WAIT")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'TIME_WAIT'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.TimeWait
-			},
-		},
-		"CLOSE": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "CLOSE")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'CLOSE'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.Close
-			},
-		},
-		"CLOSE_WAIT": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "CLOSE_WAIT")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'CLOSE_WAIT'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.CloseWait
-			},
-		},
-		"LAST_ACK": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "LAST_ACK")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'LAST_ACK'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.LastAck
-			},
-		},
-		"LISTEN": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "LISTEN")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'LISTEN'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.Listen
-			},
-		},
-		"CLOSING": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("tcp6", "CLOSING")
-			},
-			Unit:        "event",
-			Description: "Count of TCP6 connections in state 'CLOSING'",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Network.Tcp6.Closing
-			},
-		},
+// values calls emit for every device value of a per device metric in s,
+// derived ones need the previous sample prev
+func (m *Metric) values(prev, s *info.ContainerStats, emit func(d Device, v interface{})) {
+	if m.Derive == nil {
+		m.Devices(s, emit)
+		return
 	}
+	if prev != nil {
+		m.Derive(prev, s, emit)
+	}
+}
 
-	memMap = map[string]Metric{
-		"cache": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("mem", "cache")
-			},
-			Unit:        "B",
-			Description: "Number of bytes of page cache memory.",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Memory.Cache
-			},
-		},
-		"usage": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("mem", "usage")
-			},
-			Unit:        "B",
-			Description: "Current memory usage, this includes all memory regardless of when it was accessed.",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Memory.Usage
-			},
-		},
-		"rss": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("mem", "rss")
-			},
-			Unit:        "B",
-			Description: "The amount of anonymous and swap cache memory (includes transparent hugepages)",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Memory.RSS
-			},
-		},
-		"swap": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("mem", "swap")
-			},
-			Unit:        "B",
-			Description: "The amount of swap currently used by the processes in this cgroup",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Memory.Swap
-			},
-		},
-		"working_set": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("mem", "working_set")
-			},
-			Unit:        "B",
-			Description: "The amount of working set memory, this includes recently accessed memory, dirty memory, and kernel memory.",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Memory.WorkingSet
-			},
-		},
-		"failcnt": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("mem", "failcnt")
-			},
-			Unit:        "B",
-			Description: "",
-			Data: func(s *info.ContainerStats) interface{} {
-				return s.Memory.Failcnt
-			},
-		},
+// metric builds a single value of the metric named according to the scheme of series
+func (m *Metric) metric(series *containerSeries, d Device, data interface{}, timestamp time.Time) plugin.Metric {
+	name := series.name(m, d)
+	if series.scheme == schemeCadvisor {
+		return plugin.Metric{
+			Namespace:   name.namespace,
+			Description: m.Description,
+			Unit:        m.CompatUnit(),
+			Data:        m.compatData(data),
+			Tags:        name.tags,
+			Timestamp:   timestamp,
+		}
 	}
+	return plugin.Metric{
+		Namespace:   name.namespace,
+		Description: m.Description,
+		Unit:        m.Unit,
+		Data:        data,
+		Tags:        name.tags,
+		Timestamp:   timestamp,
+	}
+}
+
+// CompatNamespace returns the namespace of the metric in the cadvisor scheme
+func (m *Metric) CompatNamespace() plugin.Namespace {
+	return plugin.NewNamespace(m.Compat.Name)
+}
 
-	fsMap = map[string]Metric{
-		"total_usage": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("fs", "total_usage")
-			},
-			Unit:        "B",
-			Description: "Total Number of bytes consumed by container.",
-			Data: func(s *info.ContainerStats) interface{} {
-				return *s.Filesystem.TotalUsageBytes
-			},
-		},
-		"base_usage": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("fs", "base_usage")
-			},
-			Unit:        "B",
-			Description: "Total Number of bytes consumed by container.",
-			Data: func(s *info.ContainerStats) interface{} {
-				return *s.Filesystem.BaseUsageBytes
-			},
-		},
-		"inode_usage": Metric{
-			Namespace: func(ns string, pn string, cn string) plugin.Namespace {
-				return containerNamespace(ns, pn, cn).AddStaticElements("fs", "inode_usage")
-			},
-			Unit:        "inodes",
-			Description: "Number of inodes used within the container's root filesystem.",
-			Data: func(s *info.ContainerStats) interface{} {
-				return *s.Filesystem.InodeUsage
-			},
-		},
+// CompatUnit returns the unit of the metric in the cadvisor scheme
+func (m *Metric) CompatUnit() string {
+	if m.Compat.Unit != "" {
+		return m.Compat.Unit
 	}
+	return m.Unit
+}
 
-	diskIoMap = map[string]DiskIoMetric{
-		"read_bytes": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("read_bytes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "B",
-			Description: "Total Number of bytes read",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Read"]
-			},
-		},
-		"reads": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("reads")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total number of reads completed",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Read"]
-			},
-		},
-		"queued_reads": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("queued_reads")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total Number of reads queued",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Read"]
-			},
-		},
-		"sector_reads": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("sector_reads")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total number of sector reads completed",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Read"]
-			},
-		},
-		"merged_reads": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("merged_reads")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total number of reads merged",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Read"]
-			},
-		},
-		"read_time": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("read_time")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "ns",
-			Description: "Total number of reads completed",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Read"]
-			},
-		},
-		"write_bytes": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("write_bytes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "B",
-			Description: "Total Number of bytes write",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Write"]
-			},
-		},
-		"writes": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("writes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total number of writes completed",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Write"]
-			},
-		},
-		"queued_writes": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("queued_writes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total Number of writes queued",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Write"]
-			},
-		},
-		"sector_writes": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("sector_writes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total number of sector writes completed",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Write"]
-			},
-		},
-		"merged_writes": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("merged_writes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "event",
-			Description: "Total number of writes merged",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Write"]
-			},
-		},
-		"write_time": DiskIoMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("diskio").AddDynamicElement("device_name", "name of the disk").AddStaticElement("write_time")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "ns",
-			Description: "Total amount of time spent writing",
-			Data: func(s v1.PerDiskStats) interface{} {
-				return s.Stats["Write"]
-			},
-		},
+func (m *Metric) compatData(data interface{}) interface{} {
+	if m.Compat.Scale == 0 {
+		return data
 	}
+	f, _ := toFloat(data)
+	return f * m.Compat.Scale
+}
 
-	ifaceMap = map[string]IfaceMetric{
-		"in_bytes": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("in_bytes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "B",
-			Description: "Cumulative count of bytes received",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.RxBytes
-			},
-		},
-		"in_packets": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("in_packets")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "pckt",
-			Description: "Cumulative count of packets received",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.RxPackets
-			},
-		},
-		"in_errors": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("in_errors")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "pckt",
-			Description: "Cumulative count of errors received by the container",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.RxErrors
-			},
-		},
-		"in_dropped": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("in_dropped")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "pckt",
-			Description: "Cumulative count of bytes received by the container",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.RxDropped
-			},
-		},
-		"out_bytes": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("out_bytes")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "B",
-			Description: "Cumulative count of bytes transmitted",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.TxBytes
-			},
-		},
-		"out_packets": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("out_packets")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "pckt",
-			Description: "Cumulative count of packets transmitted",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.TxPackets
-			},
-		},
-		"out_errors": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("out_errors")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "pckt",
-			Description: "Cumulative count of errors transmitted by the container",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.TxErrors
-			},
-		},
-		"out_dropped": IfaceMetric{
-			Namespace: func(ns string, pn string, cn string, name string) plugin.Namespace {
-				metName := containerNamespace(ns, pn, cn).AddStaticElement("iface").AddDynamicElement("device_name", "name of the interface").AddStaticElement("out_dropped")
-				if name != "*" {
-					metName[7].Value = name
-				}
-				return metName
-			},
-			Unit:        "pckt",
-			Description: "Cumulative count of bytes transmitted by the container",
-			Data: func(s v1.InterfaceStats) interface{} {
-				return s.TxDropped
-			},
-		},
+func (m *Metric) compatTags(contInfo [3]string, d Device) map[string]string {
+	tags := map[string]string{
+		"namespace": contInfo[0],
+		"pod":       contInfo[1],
+		"container": contInfo[2],
+	}
+	if m.PerDevice() {
+		tags[m.Compat.Device] = d.Name
+	}
+	for k, v := range m.Compat.Labels {
+		tags[k] = v
 	}
+	return tags
+}
+
+// lookupMetric finds the registry entry a requested namespace refers to
+func lookupMetric(ns plugin.Namespace) (*Metric, bool) {
+	for _, m := range registry {
+		if m.matches(ns) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// lookupCompat finds the registry entries sharing a cadvisor scheme namespace
+func lookupCompat(ns plugin.Namespace) []*Metric {
+	if len(ns) != 1 {
+		return nil
+	}
+	metrics := []*Metric{}
+	for _, m := range registry {
+		if m.Compat.Name == ns.Element(0).Value {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// catalog returns the metrics advertised for scheme named as in schema
+// version, in registry order, leaving out the metrics caps cannot collect
+func catalog(scheme string, version int, caps *capabilities) []plugin.Metric {
+	metrics := []plugin.Metric{}
+	seen := map[string]bool{}
+	for _, m := range registryFor(version) {
+		if !caps.reports(m) {
+			continue
+		}
+		if scheme == schemeCadvisor {
+			if seen[m.Compat.Name] {
+				continue
+			}
+			seen[m.Compat.Name] = true
+			metrics = append(metrics, plugin.Metric{
+				Namespace:   m.CompatNamespace(),
+				Description: m.Description,
+				Unit:        m.CompatUnit(),
+			})
+			continue
+		}
+		metrics = append(metrics, plugin.Metric{
+			Namespace:   m.Namespace("*", "*", "*", "*"),
+			Description: m.Description,
+			Unit:        m.Unit,
+		})
+	}
+	return metrics
+}
+
+// containerNamespace returns the namespace prefix of the metrics of a
+// container, whose namespace, pod and container are dynamic elements. Passing
+// "*" leaves an element unset, as advertised in the catalog.
+func containerNamespace(ns string, pn string, cn string) plugin.Namespace {
+	prefix := plugin.NewNamespace(PluginVendor, PluginName, "container").
+		AddDynamicElement("namespace", "kubernetes namespace of the pod").
+		AddDynamicElement("pod_name", "name of the kubernetes pod").
+		AddDynamicElement("container_name", "name of the container within the pod")
+	prefix[3].Value = ns
+	prefix[4].Value = pn
+	prefix[5].Value = cn
+	return prefix
+}
+
+// optional dereferences a stat that cAdvisor may leave unset
+func optional(v *uint64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// ifaceStat extracts a value from every network interface of a container
+func ifaceStat(value func(i v1.InterfaceStats) uint64) DeviceExtractor {
+	return func(s *info.ContainerStats, emit func(d Device, v interface{})) {
+		if s.Network == nil {
+			return
+		}
+		for _, iface := range s.Network.Interfaces {
+			emit(Device{Name: iface.Name}, value(iface))
+		}
+	}
+}
+
+// diskStat extracts the op ("Read" or "Write") value from every disk listed by list
+func diskStat(list func(d *v1.DiskIoStats) []v1.PerDiskStats, op string) DeviceExtractor {
+	return func(s *info.ContainerStats, emit func(d Device, v interface{})) {
+		if s.DiskIo == nil {
+			return
+		}
+		for _, disk := range list(s.DiskIo) {
+			emit(Device{Name: disk.Device, Major: disk.Major, Minor: disk.Minor}, disk.Stats[op])
+		}
+	}
+}
+
+func ioServiceBytes(d *v1.DiskIoStats) []v1.PerDiskStats { return d.IoServiceBytes }
+func ioServiced(d *v1.DiskIoStats) []v1.PerDiskStats     { return d.IoServiced }
+func ioQueued(d *v1.DiskIoStats) []v1.PerDiskStats       { return d.IoQueued }
+func ioSectors(d *v1.DiskIoStats) []v1.PerDiskStats      { return d.Sectors }
+func ioMerged(d *v1.DiskIoStats) []v1.PerDiskStats       { return d.IoMerged }
+func ioServiceTime(d *v1.DiskIoStats) []v1.PerDiskStats  { return d.IoServiceTime }
+func ioWaitTime(d *v1.DiskIoStats) []v1.PerDiskStats     { return d.IoWaitTime }
+func ioTime(d *v1.DiskIoStats) []v1.PerDiskStats         { return d.IoTime }
+
+// familyIndex is the position of the metric family within a namespace
+const familyIndex = 6
+
+const (
+	ifaceDevice = "name of the interface"
+	diskDevice  = "name of the disk"
 )
+
+// registry holds every metric the plugin can collect, in catalog order.
+// Adding a metric only requires adding an entry here.
+var registry = []*Metric{
+	{
+		Family: "cpu", Path: []string{"total", "usage"}, Unit: "ns", Kind: Counter, Requires: HasCpu,
+		Description: "total CPU usage",
+		Compat:      Compat{Name: "container_cpu_usage_seconds_total", Unit: "s", Scale: 1e-9},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Cpu.Usage.Total },
+	},
+	{
+		Family: "cpu", Path: []string{"user", "usage"}, Unit: "ns", Kind: Counter, Requires: HasCpu,
+		Description: "user CPU usage",
+		Compat:      Compat{Name: "container_cpu_user_seconds_total", Unit: "s", Scale: 1e-9},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Cpu.Usage.User },
+	},
+	{
+		Family: "cpu", Path: []string{"system", "usage"}, Unit: "ns", Kind: Counter, Requires: HasCpu,
+		Description: "system CPU usage",
+		Compat:      Compat{Name: "container_cpu_system_seconds_total", Unit: "s", Scale: 1e-9},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Cpu.Usage.System },
+	},
+	{
+		Family: "cpu", Path: []string{"load"}, Unit: "load", Kind: Gauge, Requires: HasCpu,
+		Description: " Load is smoothed over the last 10 seconds. Instantaneous value can be read",
+		Compat:      Compat{Name: "container_cpu_load_average_10s"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Cpu.LoadAverage },
+	},
+
+	{
+		Family: "tcp", Path: []string{"ESTABLISHED"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'ESTABLISHED'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "established"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.Established },
+	},
+	{
+		Family: "tcp", Path: []string{"SYN_SENT"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'SYN_SENT'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "syn_sent"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.SynSent },
+	},
+	{
+		Family: "tcp", Path: []string{"SYN_RECV"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'SYN_RECV'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "syn_recv"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.SynRecv },
+	},
+	{
+		Family: "tcp", Path: []string{"FIN_WAIT_1"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'FIN_WAIT_1'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "fin_wait_1"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.FinWait1 },
+	},
+	{
+		Family: "tcp", Path: []string{"FIN_WAIT_2"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'FIN_WAIT_2'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "fin_wait_2"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.FinWait2 },
+	},
+	{
+		Family: "tcp", Path: []string{"TIME_WAIT"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'TIME_WAIT'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "time_wait"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.TimeWait },
+	},
+	{
+		Family: "tcp", Path: []string{"CLOSE"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'CLOSE'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "close"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.Close },
+	},
+	{
+		Family: "tcp", Path: []string{"CLOSE_WAIT"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'CLOSE_WAIT'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "close_wait"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.CloseWait },
+	},
+	{
+		Family: "tcp", Path: []string{"LAST_ACK"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'LAST_ACK'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "last_ack"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.LastAck },
+	},
+	{
+		Family: "tcp", Path: []string{"LISTEN"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'LISTEN'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "listen"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.Listen },
+	},
+	{
+		Family: "tcp", Path: []string{"CLOSING"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP connections in state 'CLOSING'",
+		Compat:      Compat{Name: "container_network_tcp_usage_total", Labels: map[string]string{"tcp_state": "closing"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp.Closing },
+	},
+
+	{
+		Family: "tcp6", Path: []string{"ESTABLISHED"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'ESTABLISHED'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "established"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.Established },
+	},
+	{
+		Family: "tcp6", Path: []string{"SYN_SENT"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'SYN_SENT'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "syn_sent"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.SynSent },
+	},
+	{
+		Family: "tcp6", Path: []string{"SYN_RECV"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'SYN_RECV'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "syn_recv"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.SynRecv },
+	},
+	{
+		Family: "tcp6", Path: []string{"FIN_WAIT_1"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'FIN_WAIT_1'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "fin_wait_1"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.FinWait1 },
+	},
+	{
+		Family: "tcp6", Path: []string{"FIN_WAIT_2"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'FIN_WAIT_2'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "fin_wait_2"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.FinWait2 },
+	},
+	{
+		Family: "tcp6", Path: []string{"TIME_WAIT"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'TIME_WAIT'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "time_wait"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.TimeWait },
+	},
+	{
+		Family: "tcp6", Path: []string{"CLOSE"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'CLOSE'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "close"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.Close },
+	},
+	{
+		Family: "tcp6", Path: []string{"CLOSE_WAIT"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'CLOSE_WAIT'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "close_wait"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.CloseWait },
+	},
+	{
+		Family: "tcp6", Path: []string{"LAST_ACK"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'LAST_ACK'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "last_ack"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.LastAck },
+	},
+	{
+		Family: "tcp6", Path: []string{"LISTEN"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'LISTEN'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "listen"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.Listen },
+	},
+	{
+		Family: "tcp6", Path: []string{"CLOSING"}, Unit: "event", Kind: Gauge, Requires: HasNetwork,
+		Description: "Count of TCP6 connections in state 'CLOSING'",
+		Compat:      Compat{Name: "container_network_tcp6_usage_total", Labels: map[string]string{"tcp_state": "closing"}},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Network.Tcp6.Closing },
+	},
+
+	{
+		Family: "mem", Path: []string{"cache"}, Unit: "B", Kind: Gauge, Requires: HasMemory,
+		Description: "Number of bytes of page cache memory.",
+		Compat:      Compat{Name: "container_memory_cache"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Memory.Cache },
+	},
+	{
+		Family: "mem", Path: []string{"usage"}, Unit: "B", Kind: Gauge, Requires: HasMemory,
+		Description: "Current memory usage, this includes all memory regardless of when it was accessed.",
+		Compat:      Compat{Name: "container_memory_usage_bytes"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Memory.Usage },
+	},
+	{
+		Family: "mem", Path: []string{"rss"}, Unit: "B", Kind: Gauge, Requires: HasMemory,
+		Description: "The amount of anonymous and swap cache memory (includes transparent hugepages)",
+		Compat:      Compat{Name: "container_memory_rss"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Memory.RSS },
+	},
+	{
+		Family: "mem", Path: []string{"swap"}, Unit: "B", Kind: Gauge, Requires: HasMemory,
+		Description: "The amount of swap currently used by the processes in this cgroup",
+		Compat:      Compat{Name: "container_memory_swap"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Memory.Swap },
+	},
+	{
+		Family: "mem", Path: []string{"working_set"}, Unit: "B", Kind: Gauge, Requires: HasMemory,
+		Description: "The amount of working set memory, this includes recently accessed memory, dirty memory, and kernel memory.",
+		Compat:      Compat{Name: "container_memory_working_set_bytes"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Memory.WorkingSet },
+	},
+	{
+		Family: "mem", Path: []string{"failcnt"}, Unit: "event", Kind: Counter, Requires: HasMemory,
+		Description: "Number of times the memory usage hit the limit",
+		Compat:      Compat{Name: "container_memory_failcnt"},
+		Data:        func(s *info.ContainerStats) interface{} { return s.Memory.Failcnt },
+	},
+
+	{
+		Family: "fs", Path: []string{"total_usage"}, Unit: "B", Kind: Gauge, Requires: HasFilesystem,
+		Description: "Total Number of bytes consumed by container.",
+		Compat:      Compat{Name: "container_fs_usage_bytes"},
+		Data:        func(s *info.ContainerStats) interface{} { return optional(s.Filesystem.TotalUsageBytes) },
+	},
+	{
+		Family: "fs", Path: []string{"base_usage"}, Unit: "B", Kind: Gauge, Requires: HasFilesystem,
+		Description: "Number of bytes consumed by the container, excluding its volumes.",
+		Compat:      Compat{Name: "container_fs_base_usage_bytes"},
+		Data:        func(s *info.ContainerStats) interface{} { return optional(s.Filesystem.BaseUsageBytes) },
+	},
+	{
+		Family: "fs", Path: []string{"inode_usage"}, Unit: "inodes", Kind: Gauge, Requires: HasFilesystem,
+		Description: "Number of inodes used within the container's root filesystem.",
+		Compat:      Compat{Name: "container_fs_inodes_usage"},
+		Data:        func(s *info.ContainerStats) interface{} { return optional(s.Filesystem.InodeUsage) },
+	},
+
+	{
+		Family: "diskio", Path: []string{"read_bytes"}, Unit: "B", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total Number of bytes read",
+		Compat:      Compat{Name: "container_fs_reads_bytes_total", Device: "device"},
+		Devices:     diskStat(ioServiceBytes, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"reads"}, Unit: "event", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total number of reads completed",
+		Compat:      Compat{Name: "container_fs_reads_total", Device: "device"},
+		Devices:     diskStat(ioServiced, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"queued_reads"}, Unit: "event", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total Number of reads queued",
+		Compat:      Compat{Name: "container_fs_reads_queued", Device: "device"},
+		Devices:     diskStat(ioQueued, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"sector_reads"}, Unit: "event", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total number of sector reads completed",
+		Compat:      Compat{Name: "container_fs_sector_reads_total", Device: "device"},
+		Devices:     diskStat(ioSectors, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"merged_reads"}, Unit: "event", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total number of reads merged",
+		Compat:      Compat{Name: "container_fs_reads_merged_total", Device: "device"},
+		Devices:     diskStat(ioMerged, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"read_time"}, Unit: "ns", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total amount of time spent reading",
+		Compat:      Compat{Name: "container_fs_read_seconds_total", Device: "device", Unit: "s", Scale: 1e-9},
+		Devices:     diskStat(ioServiceTime, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"write_bytes"}, Unit: "B", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total Number of bytes write",
+		Compat:      Compat{Name: "container_fs_writes_bytes_total", Device: "device"},
+		Devices:     diskStat(ioServiceBytes, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"writes"}, Unit: "event", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total number of writes completed",
+		Compat:      Compat{Name: "container_fs_writes_total", Device: "device"},
+		Devices:     diskStat(ioServiced, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"queued_writes"}, Unit: "event", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total Number of writes queued",
+		Compat:      Compat{Name: "container_fs_writes_queued", Device: "device"},
+		Devices:     diskStat(ioQueued, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"sector_writes"}, Unit: "event", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total number of sector writes completed",
+		Compat:      Compat{Name: "container_fs_sector_writes_total", Device: "device"},
+		Devices:     diskStat(ioSectors, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"merged_writes"}, Unit: "event", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total number of writes merged",
+		Compat:      Compat{Name: "container_fs_writes_merged_total", Device: "device"},
+		Devices:     diskStat(ioMerged, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"write_time"}, Unit: "ns", Kind: Counter, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Total amount of time spent writing",
+		Compat:      Compat{Name: "container_fs_write_seconds_total", Device: "device", Unit: "s", Scale: 1e-9},
+		Devices:     diskStat(ioServiceTime, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"read_latency"}, Unit: "ns", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Average time to service a read between samples",
+		Compat:      Compat{Name: "container_fs_read_latency_seconds", Device: "device", Unit: "s", Scale: 1e-9},
+		Derive:      diskLatency("Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"write_latency"}, Unit: "ns", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Average time to service a write between samples",
+		Compat:      Compat{Name: "container_fs_write_latency_seconds", Device: "device", Unit: "s", Scale: 1e-9},
+		Derive:      diskLatency("Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"read_iops"}, Unit: "event/s", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Reads completed per second between samples",
+		Compat:      Compat{Name: "container_fs_reads_per_second", Device: "device"},
+		Derive:      diskRate(ioServiced, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"write_iops"}, Unit: "event/s", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Writes completed per second between samples",
+		Compat:      Compat{Name: "container_fs_writes_per_second", Device: "device"},
+		Derive:      diskRate(ioServiced, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"read_throughput"}, Unit: "B/s", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Bytes read per second between samples",
+		Compat:      Compat{Name: "container_fs_reads_bytes_per_second", Device: "device"},
+		Derive:      diskRate(ioServiceBytes, "Read"),
+	},
+	{
+		Family: "diskio", Path: []string{"write_throughput"}, Unit: "B/s", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Bytes written per second between samples",
+		Compat:      Compat{Name: "container_fs_writes_bytes_per_second", Device: "device"},
+		Derive:      diskRate(ioServiceBytes, "Write"),
+	},
+	{
+		Family: "diskio", Path: []string{"queue_depth"}, Unit: "event", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Average number of requests queued or in service between samples",
+		Compat:      Compat{Name: "container_fs_io_queue_depth", Device: "device"},
+		Derive:      diskQueueDepth(),
+	},
+	{
+		Family: "diskio", Path: []string{"utilization"}, Unit: "%", Kind: Gauge, Requires: HasDiskIo,
+		DeviceName: "device_name", DeviceDescription: diskDevice,
+		Description: "Percentage of time the disk was busy with requests between samples",
+		Compat:      Compat{Name: "container_fs_io_utilization_percent", Device: "device"},
+		Derive:      diskUtilization(),
+	},
+
+	{
+		Family: "iface", Path: []string{"in_bytes"}, Unit: "B", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of bytes received",
+		Compat:      Compat{Name: "container_network_receive_bytes_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.RxBytes }),
+	},
+	{
+		Family: "iface", Path: []string{"in_packets"}, Unit: "pckt", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of packets received",
+		Compat:      Compat{Name: "container_network_receive_packets_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.RxPackets }),
+	},
+	{
+		Family: "iface", Path: []string{"in_errors"}, Unit: "pckt", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of errors received by the container",
+		Compat:      Compat{Name: "container_network_receive_errors_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.RxErrors }),
+	},
+	{
+		Family: "iface", Path: []string{"in_dropped"}, Unit: "pckt", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of packets dropped while receiving",
+		Compat:      Compat{Name: "container_network_receive_packets_dropped_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.RxDropped }),
+	},
+	{
+		Family: "iface", Path: []string{"out_bytes"}, Unit: "B", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of bytes transmitted",
+		Compat:      Compat{Name: "container_network_transmit_bytes_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.TxBytes }),
+	},
+	{
+		Family: "iface", Path: []string{"out_packets"}, Unit: "pckt", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of packets transmitted",
+		Compat:      Compat{Name: "container_network_transmit_packets_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.TxPackets }),
+	},
+	{
+		Family: "iface", Path: []string{"out_errors"}, Unit: "pckt", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of errors transmitted by the container",
+		Compat:      Compat{Name: "container_network_transmit_errors_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.TxErrors }),
+	},
+	{
+		Family: "iface", Path: []string{"out_dropped"}, Unit: "pckt", Kind: Counter, Requires: HasNetwork,
+		DeviceName: "device_name", DeviceDescription: ifaceDevice,
+		Description: "Cumulative count of packets dropped while transmitting",
+		Compat:      Compat{Name: "container_network_transmit_packets_dropped_total", Device: "interface"},
+		Devices:     ifaceStat(func(i v1.InterfaceStats) uint64 { return i.TxDropped }),
+	},
+}
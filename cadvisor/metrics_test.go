@@ -0,0 +1,234 @@
+package cadvisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+// testStats returns container stats where every metric has a distinct value
+func testStats() *info.ContainerStats {
+	return &info.ContainerStats{
+		Timestamp: time.Unix(1500000000, 0),
+		Cpu: &v1.CpuStats{
+			Usage:       v1.CpuUsage{Total: 1, User: 2, System: 3},
+			LoadAverage: 4,
+		},
+		Network: &info.NetworkStats{
+			Interfaces: []v1.InterfaceStats{
+				{Name: "eth0", RxBytes: 10, RxPackets: 11, RxErrors: 12, RxDropped: 13, TxBytes: 14, TxPackets: 15, TxErrors: 16, TxDropped: 17},
+			},
+			Tcp:  info.TcpStat{Established: 20, SynSent: 21, SynRecv: 22, FinWait1: 23, FinWait2: 24, TimeWait: 25, Close: 26, CloseWait: 27, LastAck: 28, Listen: 29, Closing: 30},
+			Tcp6: info.TcpStat{Established: 40, SynSent: 41, SynRecv: 42, FinWait1: 43, FinWait2: 44, TimeWait: 45, Close: 46, CloseWait: 47, LastAck: 48, Listen: 49, Closing: 50},
+		},
+		Memory: &v1.MemoryStats{Cache: 60, Usage: 61, RSS: 62, Swap: 63, WorkingSet: 64, Failcnt: 65},
+		Filesystem: &info.FilesystemStats{
+			TotalUsageBytes: uint64Ptr(70),
+			BaseUsageBytes:  uint64Ptr(71),
+			InodeUsage:      uint64Ptr(72),
+		},
+		DiskIo: &v1.DiskIoStats{
+			IoServiceBytes: []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": 80, "Write": 81}}},
+			IoServiced:     []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": 82, "Write": 83}}},
+			IoQueued:       []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": 84, "Write": 85}}},
+			Sectors:        []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": 86, "Write": 87}}},
+			IoMerged:       []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": 88, "Write": 89}}},
+			IoServiceTime:  []v1.PerDiskStats{{Device: "sda", Major: 8, Stats: map[string]uint64{"Read": 90, "Write": 91}}},
+		},
+	}
+}
+
+var expectedValues = map[string]interface{}{
+	"cpu/total/usage":          uint64(1),
+	"cpu/user/usage":           uint64(2),
+	"cpu/system/usage":         uint64(3),
+	"cpu/load":                 int32(4),
+	"tcp/ESTABLISHED":          uint64(20),
+	"tcp/SYN_SENT":             uint64(21),
+	"tcp/SYN_RECV":             uint64(22),
+	"tcp/FIN_WAIT_1":           uint64(23),
+	"tcp/FIN_WAIT_2":           uint64(24),
+	"tcp/TIME_WAIT":            uint64(25),
+	"tcp/CLOSE":                uint64(26),
+	"tcp/CLOSE_WAIT":           uint64(27),
+	"tcp/LAST_ACK":             uint64(28),
+	"tcp/LISTEN":               uint64(29),
+	"tcp/CLOSING":              uint64(30),
+	"tcp6/ESTABLISHED":         uint64(40),
+	"tcp6/SYN_SENT":            uint64(41),
+	"tcp6/SYN_RECV":            uint64(42),
+	"tcp6/FIN_WAIT_1":          uint64(43),
+	"tcp6/FIN_WAIT_2":          uint64(44),
+	"tcp6/TIME_WAIT":           uint64(45),
+	"tcp6/CLOSE":               uint64(46),
+	"tcp6/CLOSE_WAIT":          uint64(47),
+	"tcp6/LAST_ACK":            uint64(48),
+	"tcp6/LISTEN":              uint64(49),
+	"tcp6/CLOSING":             uint64(50),
+	"mem/cache":                uint64(60),
+	"mem/usage":                uint64(61),
+	"mem/rss":                  uint64(62),
+	"mem/swap":                 uint64(63),
+	"mem/working_set":          uint64(64),
+	"mem/failcnt":              uint64(65),
+	"fs/total_usage":           uint64(70),
+	"fs/base_usage":            uint64(71),
+	"fs/inode_usage":           uint64(72),
+	"diskio/sda/read_bytes":    uint64(80),
+	"diskio/sda/write_bytes":   uint64(81),
+	"diskio/sda/reads":         uint64(82),
+	"diskio/sda/writes":        uint64(83),
+	"diskio/sda/queued_reads":  uint64(84),
+	"diskio/sda/queued_writes": uint64(85),
+	"diskio/sda/sector_reads":  uint64(86),
+	"diskio/sda/sector_writes": uint64(87),
+	"diskio/sda/merged_reads":  uint64(88),
+	"diskio/sda/merged_writes": uint64(89),
+	"diskio/sda/read_time":     uint64(90),
+	"diskio/sda/write_time":    uint64(91),
+	"iface/eth0/in_bytes":      uint64(10),
+	"iface/eth0/in_packets":    uint64(11),
+	"iface/eth0/in_errors":     uint64(12),
+	"iface/eth0/in_dropped":    uint64(13),
+	"iface/eth0/out_bytes":     uint64(14),
+	"iface/eth0/out_packets":   uint64(15),
+	"iface/eth0/out_errors":    uint64(16),
+	"iface/eth0/out_dropped":   uint64(17),
+}
+
+func TestRegistryConvert(t *testing.T) {
+	prefix := containerNamespace("ns", "pod", "cont").String() + "/"
+	stats := testStats()
+	metrics := []plugin.Metric{}
+	for _, m := range registry {
+		metrics = m.convert(metrics, newContainerSeries([3]string{"ns", "pod", "cont"}, schemeSnap), nil, stats, nil)
+	}
+	if len(metrics) != len(expectedValues) {
+		t.Errorf("expected %d metrics, got %d", len(expectedValues), len(metrics))
+	}
+	for _, m := range metrics {
+		name := m.Namespace.String()[len(prefix):]
+		want, ok := expectedValues[name]
+		if !ok {
+			t.Errorf("unexpected metric %s", name)
+			continue
+		}
+		if m.Data != want {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", name, want, want, m.Data, m.Data)
+		}
+		if !m.Timestamp.Equal(stats.Timestamp) {
+			t.Errorf("%s: expected timestamp %v, got %v", name, stats.Timestamp, m.Timestamp)
+		}
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	seen := map[string]bool{}
+	for _, m := range registry {
+		ns := m.Namespace("*", "*", "*", "*")
+		if seen[ns.String()] {
+			t.Errorf("duplicate registry entry %s", ns.String())
+		}
+		seen[ns.String()] = true
+		found, ok := lookupMetric(ns)
+		if !ok || found != m {
+			t.Errorf("%s does not resolve to its registry entry", ns.String())
+		}
+		if m.PerDevice() == (m.Data != nil) || (m.Devices != nil && m.Derive != nil) {
+			t.Errorf("%s must set exactly one of Data, Devices and Derive", ns.String())
+		}
+		if m.PerDevice() && ns.Element(familyIndex+1).Name != m.DeviceName {
+			t.Errorf("%s is missing its dynamic device element", ns.String())
+		}
+	}
+}
+
+func TestRegistryMissingFilesystemStats(t *testing.T) {
+	stats := testStats()
+	stats.Filesystem = &info.FilesystemStats{}
+	for _, m := range registry {
+		if m.Family != "fs" {
+			continue
+		}
+		if out := m.convert(nil, newContainerSeries([3]string{"ns", "pod", "cont"}, schemeSnap), nil, stats, nil); len(out) != 0 {
+			t.Errorf("%s: expected no metric for unset stat, got %v", m.Key(), out)
+		}
+	}
+}
+
+func TestRegistryConvertCadvisorScheme(t *testing.T) {
+	stats := testStats()
+	metrics := []plugin.Metric{}
+	for _, m := range registry {
+		if m.Compat.Name == "" {
+			t.Errorf("%s has no cadvisor scheme name", m.Namespace("*", "*", "*", "*").String())
+		}
+		if m.PerDevice() && m.Compat.Device == "" {
+			t.Errorf("%s has no cadvisor scheme device label", m.Namespace("*", "*", "*", "*").String())
+		}
+		metrics = m.convert(metrics, newContainerSeries([3]string{"ns", "pod", "cont"}, schemeCadvisor), nil, stats, nil)
+	}
+	if len(metrics) != len(expectedValues) {
+		t.Errorf("expected %d metrics, got %d", len(expectedValues), len(metrics))
+	}
+	expected := map[string]struct {
+		value interface{}
+		tags  map[string]string
+	}{
+		"/container_cpu_usage_seconds_total":     {1e-9, map[string]string{}},
+		"/container_memory_working_set_bytes":    {uint64(64), map[string]string{}},
+		"/container_network_receive_bytes_total": {uint64(10), map[string]string{"interface": "eth0"}},
+		"/container_fs_reads_bytes_total":        {uint64(80), map[string]string{"device": "sda"}},
+	}
+	found := 0
+	for _, m := range metrics {
+		if m.Tags["namespace"] != "ns" || m.Tags["pod"] != "pod" || m.Tags["container"] != "cont" {
+			t.Errorf("%s: missing container tags %v", m.Namespace.String(), m.Tags)
+		}
+		if m.Namespace.String() == "/container_network_tcp_usage_total" && m.Tags["tcp_state"] == "established" {
+			if m.Data != uint64(20) {
+				t.Errorf("tcp established: expected 20, got %v", m.Data)
+			}
+			found++
+		}
+		want, ok := expected[m.Namespace.String()]
+		if !ok {
+			continue
+		}
+		found++
+		if m.Data != want.value {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", m.Namespace.String(), want.value, want.value, m.Data, m.Data)
+		}
+		for k, v := range want.tags {
+			if m.Tags[k] != v {
+				t.Errorf("%s: expected tag %s=%s, got %v", m.Namespace.String(), k, v, m.Tags)
+			}
+		}
+	}
+	if found != len(expected)+1 {
+		t.Errorf("expected %d cadvisor scheme metrics, found %d", len(expected)+1, found)
+	}
+}
+
+func TestCatalogCadvisorScheme(t *testing.T) {
+	seen := map[string]bool{}
+	for _, m := range catalog(schemeCadvisor, currentSchema, nil) {
+		if seen[m.Namespace.String()] {
+			t.Errorf("%s advertised twice", m.Namespace.String())
+		}
+		seen[m.Namespace.String()] = true
+		if len(lookupCompat(m.Namespace)) == 0 {
+			t.Errorf("%s does not resolve to a registry entry", m.Namespace.String())
+		}
+	}
+	if tcp := lookupCompat(plugin.NewNamespace("container_network_tcp_usage_total")); len(tcp) != 11 {
+		t.Errorf("expected 11 tcp states, got %d", len(tcp))
+	}
+}
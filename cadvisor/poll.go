@@ -0,0 +1,111 @@
+package cadvisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// pollIdleIntervals is the number of intervals a task may skip before the
+// samples emitted for it are forgotten, tasks are not told when they stop
+const pollIdleIntervals = 3
+
+// poller holds the state of the polling collector mode, where Snap schedules
+// collections through CollectMetrics instead of streaming
+type poller struct {
+	lock  sync.Mutex
+	tasks map[string]*polledTask
+}
+
+// polledTask is a task collecting through CollectMetrics. Its config, the
+// samples it emitted and the names of its series are kept between its
+// collections, a task whose config changes is a new task.
+type polledTask struct {
+	config  *snapshot
+	samples *sampleTracker
+	series  *seriesCache
+	// checked logs once that the source keeps less samples than the task needs
+	checked sync.Once
+	last    time.Time
+	// interval is the longest of the configured interval and the time
+	// between the last two collections of the task
+	interval time.Duration
+}
+
+func newPoller() *poller {
+	return &poller{tasks: map[string]*polledTask{}}
+}
+
+// task returns the task requesting metrics, tasks are told apart by the
+// metrics they request and their config. Tasks that did not collect for
+// pollIdleIntervals of their interval are forgotten.
+func (p *poller) task(metrics []plugin.Metric, now time.Time) *polledTask {
+	keys := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		keys = append(keys, m.Namespace.String())
+	}
+	sort.Strings(keys)
+	key := strings.Join(keys, ",") + fmt.Sprint(taskConfig(metrics))
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for k, t := range p.tasks {
+		if k != key && now.Sub(t.last) > pollIdleIntervals*t.interval {
+			delete(p.tasks, k)
+		}
+	}
+	t, ok := p.tasks[key]
+	interval := time.Duration(0)
+	if !ok {
+		if i, mixed := mixedConfig(metrics); mixed {
+			log.Printf("metrics of a task have different configs, %s and the others are collected with the config of %s\n", metrics[i].Namespace.String(), metrics[0].Namespace.String())
+		}
+		t = &polledTask{config: newSnapshot(metrics), samples: newSampleTracker(), series: newSeriesCache()}
+		p.tasks[key] = t
+	} else {
+		interval = now.Sub(t.last)
+	}
+	if interval < t.config.interval {
+		interval = t.config.interval
+	}
+	t.last, t.interval = now, interval
+	return t
+}
+
+// mixedConfig returns the index of the first metric whose config differs from
+// the one of the first metric, which is the config of the task
+func mixedConfig(metrics []plugin.Metric) (int, bool) {
+	for i := 1; i < len(metrics); i++ {
+		if !reflect.DeepEqual(metrics[i].Config, metrics[0].Config) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// CollectMetrics implements the Snap collector contract for tasks scheduled by
+// Snap. It shares the long lived container manager and the metric registry
+// with StreamMetrics, so both modes produce the same metrics.
+func (c *Collector) CollectMetrics(mts []plugin.Metric) ([]plugin.Metric, error) {
+	task := c.polling.task(mts, time.Now())
+	if task.config.filtersErr != nil {
+		return nil, task.config.filtersErr
+	}
+	if err := c.ensureSource(task.config); err != nil {
+		return nil, err
+	}
+	task.checked.Do(func() {
+		if err := c.checkHistory(task.config); err != nil {
+			log.Print(err)
+		}
+	})
+	metrics := c.collectTracked(context.Background(), task.config, task.samples, task.series)
+	return c.withSelf(task.config, metrics, time.Now()), nil
+}
@@ -0,0 +1,119 @@
+package cadvisor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func TestCollectMetricsMatchesStream(t *testing.T) {
+	requested := requestedMetrics(15,
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "reads"),
+	)
+	poll := NewCollector()
+	poll.mng = &fakeSource{}
+	polled, err := poll.CollectMetrics(requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := NewCollector()
+	stream.mng = &fakeSource{}
+	config := newSnapshot(requested)
+	streamed := stream.collect(config)
+	if len(polled) != 2 || !reflect.DeepEqual(polled, streamed) {
+		t.Errorf("polling and streaming differ:\n%v\n%v", polled, streamed)
+	}
+}
+
+func TestCollectMetricsTracksTasksSeparately(t *testing.T) {
+	c := NewCollector()
+	source := &fakeSource{stats: statsAt(10)}
+	c.mng = source
+	task1 := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"))
+	task2 := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "rss"))
+
+	for _, task := range [][]plugin.Metric{task1, task2} {
+		if metrics, _ := c.CollectMetrics(task); len(metrics) != 1 {
+			t.Errorf("expected the latest sample for every task, got %v", metrics)
+		}
+	}
+	if metrics, _ := c.CollectMetrics(task1); len(metrics) != 0 {
+		t.Errorf("expected duplicate sample to be suppressed, got %v", metrics)
+	}
+	source.stats = statsAt(20)
+	if metrics, _ := c.CollectMetrics(task1); len(metrics) != 1 {
+		t.Errorf("expected fresh sample, got %v", metrics)
+	}
+}
+
+func TestPollerEvictsIdleTasks(t *testing.T) {
+	p := newPoller()
+	task1 := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"))
+	task2 := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "rss"))
+	start := time.Unix(0, 0)
+	interval := 15 * time.Second
+
+	task := p.task(task1, start)
+	if p.task(task1, start.Add(interval)) != task {
+		t.Error("expected a task to be kept")
+	}
+	// task1 polls every minute, which is not idle for it
+	p.task(task1, start.Add(time.Minute+interval))
+	p.task(task2, start.Add(4*time.Minute))
+	if len(p.tasks) != 2 {
+		t.Fatalf("expected a task polled every minute to be kept, got %d tasks", len(p.tasks))
+	}
+	p.task(task2, start.Add(5*time.Minute))
+	if len(p.tasks) != 1 {
+		t.Fatalf("expected the idle task to be evicted, got %d tasks", len(p.tasks))
+	}
+	if p.task(task1, start.Add(5*time.Minute)) == task {
+		t.Error("expected an evicted task to start over")
+	}
+}
+
+func TestPollerKeepsTaskState(t *testing.T) {
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	requested := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"))
+	if _, err := c.CollectMetrics(requested); err != nil {
+		t.Fatal(err)
+	}
+	task := c.polling.task(requested, time.Now())
+	config, series := task.config, task.series
+	if len(series.containers) == 0 {
+		t.Fatal("expected the task to name its series in its own cache")
+	}
+	if len(c.series.containers) != 0 {
+		t.Errorf("expected the series of the stream to be left alone, got %v", c.series.containers)
+	}
+	if _, err := c.CollectMetrics(requested); err != nil {
+		t.Fatal(err)
+	}
+	if task.config != config || task.series != series {
+		t.Error("expected the config and the series of a task to be kept between its collections")
+	}
+	changed := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"))
+	changed[0].Config["scheme"] = schemeCadvisor
+	if other := c.polling.task(changed, time.Now()); other == task || other.config == config || other.series == series {
+		t.Error("expected a task whose config changed to start over")
+	}
+}
+
+func TestMixedConfig(t *testing.T) {
+	metrics := requestedMetrics(15,
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "rss"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "cache"),
+	)
+	if _, mixed := mixedConfig(metrics); mixed {
+		t.Error("expected equal configs not to be mixed")
+	}
+	metrics[2].Config = plugin.Config{"interval": int64(15), "scheme": schemeCadvisor}
+	if i, mixed := mixedConfig(metrics); !mixed || i != 2 {
+		t.Errorf("expected the config of the third metric to differ, got %d %v", i, mixed)
+	}
+}
@@ -0,0 +1,170 @@
+package cadvisor
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// converted locates the metrics of a container within the buffer of the
+// worker that converted it
+type converted struct {
+	worker, start, end int
+}
+
+// batches holds the buffers workers convert containers into, they never leave
+// the package and are reused by the following collections
+var batches = sync.Pool{New: func() interface{} { return &[]plugin.Metric{} }}
+
+// poolSize returns the number of workers converting n containers
+func (s *snapshot) poolSize(n int) int {
+	workers := s.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// lister lists the containers of the source for the collections. A listing
+// that outlives the deadline of its collection is shared with the following
+// collections until it returns, so a stuck source does not pile up calls.
+type lister struct {
+	lock    sync.Mutex
+	pending *listing
+}
+
+// listing is a call to GetContainerInfoV2 for count samples per container
+type listing struct {
+	count      int
+	done       chan struct{}
+	containers map[string]info.ContainerInfo
+	err        error
+}
+
+// list returns the containers of source with count samples each, or the error
+// of ctx when it is done first
+func (l *lister) list(ctx context.Context, source containerSource, count int) (map[string]info.ContainerInfo, error) {
+	l.lock.Lock()
+	call := l.pending
+	if call == nil || call.count != count {
+		call = &listing{count: count, done: make(chan struct{})}
+		l.pending = call
+		go func() {
+			call.containers, call.err = source.GetContainerInfoV2("/", info.RequestOptions{Count: count, Recursive: true, IdType: info.TypeName})
+			close(call.done)
+			l.lock.Lock()
+			if l.pending == call {
+				l.pending = nil
+			}
+			l.lock.Unlock()
+		}()
+	}
+	l.lock.Unlock()
+	select {
+	case <-call.done:
+		return call.containers, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// convertContainers converts the named containers on a bounded pool of
+// workers and returns their metrics in the order of names, so the result does
+// not depend on scheduling. Containers not handed to a worker or not
+// converted before ctx is done are skipped, their number is returned.
+func (c *Collector) convertContainers(ctx context.Context, config *snapshot, samples *sampleTracker, series *seriesCache, names []string, containers map[string]info.ContainerInfo) ([]plugin.Metric, int) {
+	workers := config.poolSize(len(names))
+	buffers := make([][]plugin.Metric, workers)
+	located := make([]converted, len(names))
+	jobs := make(chan int)
+	var interrupted int32
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		buffers[w] = (*batches.Get().(*[]plugin.Metric))[:0]
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range jobs {
+				start := len(buffers[w])
+				var done bool
+				if buffers[w], done = c.convertContainer(ctx, config, samples, series, names[i], containers[names[i]], buffers[w]); !done {
+					atomic.AddInt32(&interrupted, 1)
+				}
+				located[i] = converted{worker: w, start: start, end: len(buffers[w])}
+			}
+		}(w)
+	}
+
+	skipped := 0
+	for i, name := range names {
+		if ctx.Err() == nil {
+			select {
+			case jobs <- i:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		// the container keeps its state as if it was not collected this time
+		skipped++
+		samples.keep(name)
+		if contInfo, ok := checkContainer(containers[name].Spec.Labels); ok {
+			series.container(name, contInfo, config.scheme)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	skipped += int(interrupted)
+
+	total := 0
+	for _, buffer := range buffers {
+		total += len(buffer)
+	}
+	kept := c.limitSeries(config, names, containers, located, total)
+	metrics := make([]plugin.Metric, 0, total)
+	for i := range names {
+		if l := located[i]; kept == nil || kept[i] {
+			metrics = append(metrics, buffers[l.worker][l.start:l.end]...)
+		}
+	}
+	for w := range buffers {
+		// drop the references to the emitted values before reusing the buffer
+		for i := range buffers[w] {
+			buffers[w][i] = plugin.Metric{}
+		}
+		batches.Put(&buffers[w])
+	}
+	return metrics, skipped
+}
+
+// limitSeries applies the series limit to a collection of total series, it
+// returns which containers are kept or nil when all of them are
+func (c *Collector) limitSeries(config *snapshot, names []string, containers map[string]info.ContainerInfo, located []converted, total int) []bool {
+	if config.limits.series <= 0 || total <= config.limits.series {
+		return nil
+	}
+	sizes := make([]int, len(names))
+	for i, l := range located {
+		sizes[i] = l.end - l.start
+	}
+	kept := config.limits.keepContainers(names, containers, sizes)
+	dropped := 0
+	for i := range names {
+		if !kept[i] {
+			dropped += sizes[i]
+		}
+	}
+	atomic.AddUint64(&c.stats.droppedSeries, uint64(dropped))
+	log.Printf("%d series exceed max_series of %d, dropped %d series", total, config.limits.series, dropped)
+	return kept
+}
@@ -0,0 +1,142 @@
+package cadvisor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// collectWith collects twice from a new synthetic node of shape with the
+// given workers, returning the second collection which has derived metrics
+func collectWith(t *testing.T, shape syntheticShape, workers int) []plugin.Metric {
+	c := NewCollector()
+	config := newSnapshot(syntheticMetrics(shape))
+	config.workers = workers
+	if err := c.ensureSource(config); err != nil {
+		t.Fatal(err)
+	}
+	c.collect(config)
+	return c.collect(config)
+}
+
+func TestConvertContainersDeterministic(t *testing.T) {
+	shape := syntheticShape{containers: 50, interfaces: 2, disks: 1}
+	serial := collectWith(t, shape, 1)
+	if len(serial) != syntheticSeries(shape) {
+		t.Fatalf("expected %d series, got %d", syntheticSeries(shape), len(serial))
+	}
+	for _, workers := range []int{2, 7, 64} {
+		if parallel := collectWith(t, shape, workers); !reflect.DeepEqual(serial, parallel) {
+			t.Errorf("%d workers emit differently than a single one", workers)
+		}
+	}
+}
+
+func TestCollectTimeout(t *testing.T) {
+	c := NewCollector()
+	source := &fakeSource{stats: statsAt(10)}
+	c.mng = source
+	config := newSnapshot(requestedMetrics(15, registry[0].Namespace("*", "*", "*", "*")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if metrics := c.collectTracked(ctx, config, c.samples, c.series); len(metrics) != 0 {
+		t.Errorf("expected no metrics past the deadline, got %v", metrics)
+	}
+	if c.stats.timeouts != 1 {
+		t.Errorf("expected the timeout to be counted, got %d", c.stats.timeouts)
+	}
+	// the skipped container is collected by the next collection
+	if metrics := c.collect(config); len(metrics) != 1 {
+		t.Errorf("expected the skipped container to be collected, got %v", metrics)
+	}
+	if c.stats.timeouts != 1 {
+		t.Errorf("unexpected timeout, got %d", c.stats.timeouts)
+	}
+}
+
+func TestCollectTimeoutSlowSource(t *testing.T) {
+	c := NewCollector()
+	source := &fakeSource{stats: statsAt(10), delay: 200 * time.Millisecond}
+	c.mng = source
+	config := newSnapshot(requestedMetrics(15, registry[0].Namespace("*", "*", "*", "*")))
+	config.timeout = 20 * time.Millisecond
+
+	start := time.Now()
+	if metrics := c.collect(config); len(metrics) != 0 {
+		t.Errorf("expected no metrics before the source answered, got %v", metrics)
+	}
+	if elapsed := time.Since(start); elapsed >= source.delay {
+		t.Errorf("expected the collection to end at its deadline, took %v", elapsed)
+	}
+	if c.stats.timeouts != 1 {
+		t.Errorf("expected the timeout to be counted, got %d", c.stats.timeouts)
+	}
+	// the next collection waits for the pending call instead of making another
+	config.timeout = time.Second
+	if metrics := c.collect(config); len(metrics) != 1 {
+		t.Errorf("expected the container listed by the pending call to be collected, got %v", metrics)
+	}
+	if source.calls != 1 {
+		t.Errorf("expected the pending call to be shared, got %d calls", source.calls)
+	}
+}
+
+func TestConvertContainerInterrupted(t *testing.T) {
+	c := NewCollector()
+	source := &fakeSource{stats: statsAt(10)}
+	config := newSnapshot(requestedMetrics(15, registry[0].Namespace("*", "*", "*", "*")))
+	containers, _ := source.GetContainerInfoV2("/", info.RequestOptions{})
+	name := "/kubepods/pod1/cont1"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	metrics, done := c.convertContainer(ctx, config, c.samples, c.series, name, containers[name], []plugin.Metric{})
+	if done || len(metrics) != 0 {
+		t.Errorf("expected an interrupted conversion to append nothing, got %v %v", done, metrics)
+	}
+	c.samples.commit()
+	if fresh := c.samples.fresh(name, containers[name].Stats, false); len(fresh) != 1 {
+		t.Errorf("expected the interrupted container to keep its samples, got %v", fresh)
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	for _, tc := range []struct {
+		workers, containers, expected int
+	}{
+		{workers: 4, containers: 100, expected: 4},
+		{workers: 4, containers: 2, expected: 2},
+		{workers: 4, containers: 0, expected: 1},
+	} {
+		config := &snapshot{workers: tc.workers}
+		if size := config.poolSize(tc.containers); size != tc.expected {
+			t.Errorf("%d workers for %d containers: expected %d, got %d", tc.workers, tc.containers, tc.expected, size)
+		}
+	}
+}
+
+// BenchmarkCollectWorkers collects a large synthetic node with pools of different sizes
+func BenchmarkCollectWorkers(b *testing.B) {
+	shape := syntheticShape{containers: 500, interfaces: 30, disks: 2}
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			c := NewCollector()
+			config := newSnapshot(syntheticMetrics(shape))
+			config.workers = workers
+			if err := c.ensureSource(config); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.collect(config)
+			}
+		})
+	}
+}
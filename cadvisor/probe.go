@@ -0,0 +1,171 @@
+package cadvisor
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeDialTimeout bounds the probe of a container runtime socket
+const runtimeDialTimeout = time.Second
+
+// probeCheck is a single check of the capability probe, the families it
+// lists cannot be collected when it fails
+type probeCheck struct {
+	name     string
+	families []string
+	run      func(h hostPaths) error
+}
+
+// probeChecks holds every check of the capability probe, in report order
+var probeChecks = []probeCheck{
+	{name: "cgroup_cpu", families: []string{"cpu"}, run: cgroupReadable("cpuacct", "cpuacct.usage")},
+	{name: "cgroup_memory", families: []string{"mem"}, run: cgroupReadable("memory", "memory.usage_in_bytes")},
+	{name: "cgroup_blkio", families: []string{"diskio"}, run: cgroupReadable("blkio", "blkio.io_service_bytes_recursive", "blkio.throttle.io_service_bytes")},
+	{name: "net_dev", families: []string{"iface"}, run: procReadable("net/dev")},
+	{name: "tcp", families: []string{"tcp"}, run: procReadable("net/tcp")},
+	{name: "tcp6", families: []string{"tcp6"}, run: procReadable("net/tcp6")},
+	{name: "docker", run: func(h hostPaths) error { return runtimeReachable(h.docker()) }},
+	{name: "containerd", run: func(h hostPaths) error { return runtimeReachable(h.containerd()) }},
+}
+
+// capabilities is what the capability probe found the plugin can read on
+// the host. Families whose check failed are disabled, a nil capabilities
+// probed nothing and disables nothing.
+type capabilities struct {
+	// failed holds the error of every check that failed by name
+	failed map[string]error
+	// disabled holds the check that disabled every family
+	disabled map[string]string
+	// unreported holds the ids of the metrics of collected families the
+	// source never fills in, which are left out instead of emitted as 0
+	unreported map[string]bool
+}
+
+// collects reports whether family can be collected
+func (c *capabilities) collects(family string) bool {
+	if c == nil {
+		return true
+	}
+	_, ok := c.disabled[family]
+	return !ok
+}
+
+// reports reports whether metric m is collected, its family is not disabled
+// and the source fills it in
+func (c *capabilities) reports(m *Metric) bool {
+	if c == nil {
+		return true
+	}
+	return c.collects(m.Family) && !c.unreported[m.id()]
+}
+
+// available reports whether the named check passed
+func (c *capabilities) available(check string) bool {
+	if c == nil {
+		return true
+	}
+	_, ok := c.failed[check]
+	return !ok
+}
+
+// runProbe runs every check of the capability probe on host and logs the
+// outcome, the families of the failed checks are disabled
+func runProbe(host hostPaths) *capabilities {
+	caps := &capabilities{failed: map[string]error{}, disabled: map[string]string{}}
+	passed := []string{}
+	for _, check := range probeChecks {
+		err := check.run(host)
+		if err == nil {
+			passed = append(passed, check.name)
+			continue
+		}
+		caps.failed[check.name] = err
+		for _, family := range check.families {
+			caps.disabled[family] = check.name
+		}
+		if len(check.families) > 0 {
+			log.Printf("capability probe: %s unavailable, disabling %s metrics: %v\n", check.name, strings.Join(check.families, ", "), err)
+		} else {
+			log.Printf("capability probe: %s unavailable: %v\n", check.name, err)
+		}
+	}
+	if !caps.available("docker") && !caps.available("containerd") {
+		log.Printf("capability probe: no container runtime reachable, containers will lack their kubernetes labels\n")
+	}
+	log.Printf("capability probe: %s available\n", strings.Join(passed, ", "))
+	return caps
+}
+
+var (
+	probesLock sync.Mutex
+	probes     = map[hostPaths]*capabilities{}
+)
+
+// probeFor returns the capabilities of host, which is probed once for the
+// lifetime of the plugin
+func probeFor(host hostPaths) *capabilities {
+	probesLock.Lock()
+	defer probesLock.Unlock()
+	caps, ok := probes[host]
+	if !ok {
+		caps = runProbe(host)
+		probes[host] = caps
+	}
+	return caps
+}
+
+// probeHost returns the capabilities of the host the cadvisor source reads,
+// tests replace it to not depend on the privileges they run with
+var probeHost = probeFor
+
+// cgroupReadable checks that the cgroup controller is mounted below the
+// cgroup root and that one of files of its root cgroup can be read
+func cgroupReadable(controller string, files ...string) func(h hostPaths) error {
+	return func(h hostPaths) error {
+		var err error
+		for _, file := range files {
+			if err = readable(filepath.Join(h.cgroup, controller, file)); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+// procReadable checks that file of the init process can be read below the
+// procfs root, like cAdvisor reads it for the processes of containers
+func procReadable(file string) func(h hostPaths) error {
+	return func(h hostPaths) error {
+		return readable(filepath.Join(h.procfs, "1", file))
+	}
+}
+
+// readable checks that the start of the file at path can be read
+func readable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 64)); err != nil && err != io.EOF {
+		return fmt.Errorf("read %s: %v", path, err)
+	}
+	return nil
+}
+
+// runtimeReachable checks that a container runtime accepts connections on
+// the unix socket at path
+func runtimeReachable(path string) error {
+	conn, err := net.DialTimeout("unix", path, runtimeDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,129 @@
+package cadvisor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// writeFiles creates empty files at the paths below root
+func writeFiles(t *testing.T, root string, paths ...string) {
+	for _, path := range paths {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunProbe(t *testing.T) {
+	root := fakeRootfs(t)
+	defer os.RemoveAll(root)
+	// the memory and blkio cgroups and tcp6 are missing, blkio only has the
+	// throttling stats
+	writeFiles(t, root,
+		"sys/fs/cgroup/cpuacct/cpuacct.usage",
+		"sys/fs/cgroup/blkio/blkio.throttle.io_service_bytes",
+		"proc/1/net/dev",
+		"proc/1/net/tcp",
+	)
+	if err := os.MkdirAll(filepath.Join(root, "var/run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	docker, err := net.Listen("unix", filepath.Join(root, "var/run/docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer docker.Close()
+
+	caps := runProbe(hostPathsOf(plugin.Config{"rootfs": root}))
+	for check, expected := range map[string]bool{
+		"cgroup_cpu":    true,
+		"cgroup_memory": false,
+		"cgroup_blkio":  true,
+		"net_dev":       true,
+		"tcp":           true,
+		"tcp6":          false,
+		"docker":        true,
+		"containerd":    false,
+	} {
+		if caps.available(check) != expected {
+			t.Errorf("%s: expected available to be %v, got %v", check, expected, caps.failed[check])
+		}
+	}
+	if len(caps.disabled) != 2 || caps.collects("mem") || caps.collects("tcp6") || !caps.collects("diskio") {
+		t.Errorf("expected mem and tcp6 to be disabled, got %v", caps.disabled)
+	}
+}
+
+func TestDisabledFamilies(t *testing.T) {
+	caps := &capabilities{
+		failed:   map[string]error{"tcp": os.ErrPermission},
+		disabled: map[string]string{"tcp": "tcp"},
+	}
+	probeHost = func(hostPaths) *capabilities { return caps }
+	defer func() { probeHost = func(hostPaths) *capabilities { return nil } }()
+
+	c := NewCollector()
+	for _, cfg := range []plugin.Config{{}, {"scheme": schemeCadvisor, "stats": "tcp:max;mem:max"}} {
+		metrics, err := c.GetMetricTypes(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range metrics {
+			found := lookupCompat(m.Namespace)
+			if met, ok := lookupMetric(m.Namespace); ok {
+				found = append(found, met)
+			}
+			if stat, ok := lookupStat(m.Namespace); ok {
+				found = append(found, stat.metric)
+			}
+			for _, stat := range lookupCompatStats(m.Namespace) {
+				found = append(found, stat.metric)
+			}
+			for _, met := range found {
+				if met.Family == "tcp" {
+					t.Errorf("disabled tcp metric %s advertised", m.Namespace.String())
+				}
+			}
+		}
+	}
+	// replayed hosts are not probed, and pruning can be turned off
+	for _, cfg := range []plugin.Config{{"source": sourceReplay}, {"prune_catalog": false}} {
+		if metrics, _ := c.GetMetricTypes(cfg); len(metrics) != len(registry)+len(selfRegistry) {
+			t.Errorf("%v: expected the whole catalog, got %d metrics", cfg, len(metrics))
+		}
+	}
+
+	requested := requestAll(plugin.Config{"stats": "tcp:max;mem:max"})
+	for _, r := range statCatalog(requested[0].Config) {
+		requested = append(requested, plugin.Metric{Namespace: r.Namespace("*", "*", "*", "*"), Config: requested[0].Config})
+	}
+	config := newSnapshot(requested)
+	for _, m := range config.manifest.metrics {
+		if m.Family == "tcp" {
+			t.Errorf("disabled metric %s requested", m.Key())
+		}
+	}
+	if len(config.manifest.stats) != 6 {
+		t.Errorf("expected the 6 mem summaries only, got %v", config.manifest.stats)
+	}
+
+	c.mng = &fakeSource{}
+	c.collect(config)
+	values := map[string]interface{}{}
+	for _, m := range c.stats.convert(nil, selfRegistry, testStats().Timestamp) {
+		values[m.Namespace.String()] = m.Data
+	}
+	prefix := "/" + PluginVendor + "/" + PluginName + "/plugin/capabilities/"
+	if values[prefix+"tcp"] != uint64(0) || values[prefix+"cgroup_cpu"] != uint64(1) || values[prefix+"disabled_families"] != uint64(1) {
+		t.Errorf("unexpected capability metrics %v", values)
+	}
+}
@@ -0,0 +1,269 @@
+package cadvisor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// promSeriesTTL is how long the exporter keeps serving a series no emission
+// refreshed, the staleness period of Prometheus
+const promSeriesTTL = 5 * time.Minute
+
+// exporter serves the newest sample of every series the stream emitted in
+// the Prometheus text format, it never collects on its own. Emissions only
+// hold the samples that are new, so each one is merged into the series served.
+type exporter struct {
+	lock   sync.RWMutex
+	series map[string]promSeries
+	addr   string
+	server *http.Server
+}
+
+// promSeries is the newest sample of a series and when an emission last held it
+type promSeries struct {
+	sample  promSample
+	updated time.Time
+}
+
+func newExporter() *exporter {
+	return &exporter{series: map[string]promSeries{}}
+}
+
+// update merges the latest emission into the series served
+func (e *exporter) update(metrics []plugin.Metric) {
+	e.merge(metrics, time.Now())
+}
+
+// merge keeps the newest sample of every series of metrics, emitted at now,
+// and forgets the series no emission held for promSeriesTTL
+func (e *exporter) merge(metrics []plugin.Metric, now time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, m := range metrics {
+		s, ok := promSampleOf(m)
+		if !ok {
+			continue
+		}
+		key := s.key()
+		if current, ok := e.series[key]; ok && current.sample.timestamp.After(s.timestamp) {
+			s = current.sample
+		}
+		e.series[key] = promSeries{sample: s, updated: now}
+	}
+	for key, series := range e.series {
+		if now.Sub(series.updated) > promSeriesTTL {
+			delete(e.series, key)
+		}
+	}
+}
+
+// listen makes the exporter serve on addr, an empty addr stops serving and
+// forgets the series. An address that failed to bind is tried again on the
+// next call. The previous server is shut down without holding the lock, so
+// scrapes and emissions are not blocked while its connections drain.
+func (e *exporter) listen(addr string) error {
+	e.lock.Lock()
+	if addr == e.addr {
+		e.lock.Unlock()
+		return nil
+	}
+	stopped := e.server
+	e.server, e.addr = nil, ""
+	if addr == "" {
+		e.series = map[string]promSeries{}
+	}
+	e.lock.Unlock()
+	if stopped != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		stopped.Shutdown(ctx)
+		cancel()
+	}
+	if addr == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to serve prometheus metrics on %s: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	server := &http.Server{Handler: mux}
+	e.lock.Lock()
+	e.server, e.addr = server, addr
+	e.lock.Unlock()
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("prometheus endpoint stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// close stops serving
+func (e *exporter) close() {
+	e.listen("")
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.lock.RLock()
+	samples := make([]promSample, 0, len(e.series))
+	for _, series := range e.series {
+		samples = append(samples, series.sample)
+	}
+	e.lock.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := writeSamples(w, samples); err != nil {
+		log.Printf("unable to write prometheus metrics: %v\n", err)
+	}
+}
+
+// promSample is a single metric translated into a Prometheus sample
+type promSample struct {
+	name      string
+	labels    string
+	help      string
+	kind      Kind
+	value     float64
+	timestamp time.Time
+}
+
+// key identifies the series of a sample
+func (s promSample) key() string {
+	return s.name + "{" + s.labels + "}"
+}
+
+// promSampleOf translates a metric into a Prometheus sample, static namespace
+// elements form the name, dynamic elements and tags become labels
+func promSampleOf(m plugin.Metric) (promSample, bool) {
+	value, ok := toFloat(m.Data)
+	if !ok {
+		return promSample{}, false
+	}
+	parts := []string{}
+	labels := []string{}
+	for _, e := range m.Namespace {
+		if e.IsDynamic() {
+			labels = append(labels, promName(e.Name)+`="`+promLabelValue(e.Value)+`"`)
+			continue
+		}
+		parts = append(parts, e.Value)
+	}
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels = append(labels, promName(k)+`="`+promLabelValue(m.Tags[k])+`"`)
+	}
+	return promSample{
+		name:      promName(strings.Join(parts, "_")),
+		labels:    strings.Join(labels, ","),
+		help:      m.Description,
+		kind:      kindOf(m.Namespace),
+		value:     value,
+		timestamp: m.Timestamp,
+	}, true
+}
+
+// kindOf returns the kind of the metric a namespace was built from, in any
+// schema version
+func kindOf(ns plugin.Namespace) Kind {
+	if m, ok := lookupMetric(canonical(ns)); ok {
+		return m.Kind
+	}
+	if m, ok := lookupSelfMetric(ns); ok {
+		return m.Kind
+	}
+	if m := lookupCompat(ns); len(m) > 0 {
+		return m[0].Kind
+	}
+	return Gauge
+}
+
+// promName replaces the characters Prometheus does not allow in names
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// writePrometheus writes metrics in the Prometheus text exposition format,
+// sorted by name and labels. A series is written once with its newest sample,
+// high resolution emissions hold several samples of the same series.
+func writePrometheus(w io.Writer, metrics []plugin.Metric) error {
+	newest := map[string]promSample{}
+	for _, m := range metrics {
+		s, ok := promSampleOf(m)
+		if !ok {
+			continue
+		}
+		if current, ok := newest[s.key()]; ok && current.timestamp.After(s.timestamp) {
+			continue
+		}
+		newest[s.key()] = s
+	}
+	samples := make([]promSample, 0, len(newest))
+	for _, s := range newest {
+		samples = append(samples, s)
+	}
+	return writeSamples(w, samples)
+}
+
+// writeSamples writes samples in the Prometheus text exposition format,
+// sorted by name and labels
+func writeSamples(w io.Writer, samples []promSample) error {
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].name != samples[j].name {
+			return samples[i].name < samples[j].name
+		}
+		return samples[i].labels < samples[j].labels
+	})
+	buf := bufio.NewWriter(w)
+	for i, s := range samples {
+		if i == 0 || samples[i-1].name != s.name {
+			kind := "gauge"
+			if s.kind == Counter {
+				kind = "counter"
+			}
+			fmt.Fprintf(buf, "# HELP %s %s\n", s.name, promHelp(s.help))
+			fmt.Fprintf(buf, "# TYPE %s %s\n", s.name, kind)
+		}
+		if s.labels != "" {
+			fmt.Fprintf(buf, "%s{%s} %s\n", s.name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+		} else {
+			fmt.Fprintf(buf, "%s %s\n", s.name, strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	return buf.Flush()
+}
+
+// the escapers of the exposition format are built once, building a replacer
+// is far more expensive than using it
+var (
+	promHelpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func promHelp(help string) string {
+	return promHelpEscaper.Replace(strings.TrimSpace(help))
+}
+
+func promLabelValue(value string) string {
+	return promLabelEscaper.Replace(value)
+}
@@ -0,0 +1,222 @@
+package cadvisor
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func promTestMetrics() []plugin.Metric {
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	requested := requestedMetrics(15,
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "iface", "*", "in_bytes"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "cpu", "total", "usage"),
+		plugin.NewNamespace(PluginVendor, PluginName, "plugin", "scheduler", "overruns"),
+	)
+	for _, m := range requested {
+		// the labels of the expositions do not depend on the host
+		m.Config["host_tags"] = false
+	}
+	config := newSnapshot(requested)
+	metrics := c.collect(config)
+	return c.stats.convert(metrics, config.manifest.self, testStats().Timestamp)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writePrometheus(buf, promTestMetrics()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP grafanalabs_cadvisor_container_cpu_total_usage total CPU usage
+# TYPE grafanalabs_cadvisor_container_cpu_total_usage counter
+grafanalabs_cadvisor_container_cpu_total_usage{namespace="ns",pod_name="pod",container_name="cont"} 1
+# HELP grafanalabs_cadvisor_container_iface_in_bytes Cumulative count of bytes received
+# TYPE grafanalabs_cadvisor_container_iface_in_bytes counter
+grafanalabs_cadvisor_container_iface_in_bytes{namespace="ns",pod_name="pod",container_name="cont",device_name="eth0"} 10
+# HELP grafanalabs_cadvisor_container_mem_usage Current memory usage, this includes all memory regardless of when it was accessed.
+# TYPE grafanalabs_cadvisor_container_mem_usage gauge
+grafanalabs_cadvisor_container_mem_usage{namespace="ns",pod_name="pod",container_name="cont"} 61
+# HELP grafanalabs_cadvisor_plugin_scheduler_overruns Number of emissions that did not complete before the next aligned interval boundary
+# TYPE grafanalabs_cadvisor_plugin_scheduler_overruns counter
+grafanalabs_cadvisor_plugin_scheduler_overruns 0
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestPromLabelEscaping(t *testing.T) {
+	ns := plugin.NewNamespace("a-b").AddDynamicElement("device", "").AddStaticElement("c.d")
+	ns[1].Value = "a\"b\\c\n"
+	s, ok := promSampleOf(plugin.Metric{Namespace: ns, Data: uint64(1)})
+	if !ok || s.name != "a_b_c_d" {
+		t.Errorf("unexpected sample name %q", s.name)
+	}
+	if s.labels != `device="a\"b\\c\n"` {
+		t.Errorf("label value not escaped: %s", s.labels)
+	}
+}
+
+func TestExporterServesLastEmission(t *testing.T) {
+	e := newExporter()
+	if err := e.listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer e.close()
+	e.update(promTestMetrics())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `grafanalabs_cadvisor_container_mem_usage{namespace="ns",pod_name="pod",container_name="cont"} 61`) {
+		t.Errorf("last emission not served:\n%s", rec.Body.String())
+	}
+}
+
+func TestExporterMergesEmissions(t *testing.T) {
+	c := NewCollector()
+	source := &fakeSource{stats: statsAt(10, 20, 30)}
+	c.mng = source
+	config := newSnapshot(requestedMetrics(15,
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "cpu", "total", "usage"),
+	))
+	config.highRes, config.hostTags = true, false
+	e := newExporter()
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+	series := `grafanalabs_cadvisor_container_mem_usage{namespace="ns",pod_name="pod",container_name="cont"} `
+
+	// a new container emits its newest sample
+	e.merge(c.collect(config), time.Unix(30, 0))
+	stats := statsAt(10, 20, 30, 40, 50)
+	stats[3].Memory.Usage = 100
+	stats[4].Memory.Usage = 200
+	source.stats = stats
+	// high resolution backfills two samples of the same series
+	emitted := c.collect(config)
+	if len(emitted) != 4 {
+		t.Fatalf("expected two samples of two series, got %d", len(emitted))
+	}
+	e.merge(emitted, time.Unix(50, 0))
+	body := scrape()
+	if strings.Count(body, series) != 1 || !strings.Contains(body, series+"200\n") {
+		t.Errorf("expected the newest sample of the series once:\n%s", body)
+	}
+	// the next emission has no new sample, the series are still served
+	next := c.collect(config)
+	if len(next) != 0 {
+		t.Fatalf("expected duplicate samples to be suppressed, got %v", next)
+	}
+	e.merge(next, time.Unix(65, 0))
+	if again := scrape(); again != body {
+		t.Errorf("expected the series to be kept between emissions:\n%s", again)
+	}
+	// an older sample never replaces a newer one
+	older := emitted[0]
+	older.Data, older.Timestamp = uint64(1), time.Unix(5, 0)
+	e.merge([]plugin.Metric{older}, time.Unix(80, 0))
+	if !strings.Contains(scrape(), series+"200\n") {
+		t.Error("expected an older sample to be ignored")
+	}
+	// series no emission held for the staleness period are dropped
+	e.merge(nil, time.Unix(80, 0).Add(promSeriesTTL+time.Second))
+	if body := scrape(); body != "" {
+		t.Errorf("expected stale series to be dropped:\n%s", body)
+	}
+}
+
+func TestKindOfSchemaVersions(t *testing.T) {
+	for _, version := range []int{schemaV1, schemaV2} {
+		for _, m := range registryFor(version) {
+			if m.Family != "iface" {
+				continue
+			}
+			ns := m.Namespace("ns", "pod", "cont", "eth0")
+			if kind := kindOf(ns); kind != m.Kind {
+				t.Errorf("%s: expected kind %v, got %v", ns.String(), m.Kind, kind)
+			}
+		}
+	}
+}
+
+func TestExporterRetriesFailedListen(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := busy.Addr().String()
+	e := newExporter()
+	defer e.close()
+	if err := e.listen(addr); err == nil {
+		t.Fatal("expected binding a busy address to fail")
+	}
+	if err := e.listen(addr); err == nil {
+		t.Error("expected the busy address to be tried again")
+	}
+	busy.Close()
+	if err := e.listen(addr); err != nil {
+		t.Errorf("expected the freed address to be bound, got %v", err)
+	}
+}
+
+func TestExporterForgetsSeriesWhenStopped(t *testing.T) {
+	e := newExporter()
+	if err := e.listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	e.update(promTestMetrics())
+	e.close()
+	if len(e.series) != 0 || e.server != nil {
+		t.Errorf("expected a stopped exporter to forget its series, got %d", len(e.series))
+	}
+}
+
+func TestStreamWithoutPrometheus(t *testing.T) {
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mtxIn := make(chan []plugin.Metric)
+	mtxOut := make(chan []plugin.Metric)
+	go c.StreamMetrics(ctx, mtxIn, mtxOut, make(chan string, 1))
+	<-mtxOut
+	mtxIn <- requestedMetrics(3600, registry[0].Namespace("*", "*", "*", "*"))
+	if metrics := <-mtxOut; len(metrics) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(metrics))
+	}
+	c.exporter.lock.RLock()
+	defer c.exporter.lock.RUnlock()
+	if len(c.exporter.series) != 0 {
+		t.Errorf("expected emissions not to be kept without prometheus_listen, got %d series", len(c.exporter.series))
+	}
+}
+
+func TestWritePrometheusCadvisorScheme(t *testing.T) {
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	metrics := c.collect(newSnapshot([]plugin.Metric{{
+		Namespace: plugin.NewNamespace("container_network_receive_bytes_total"),
+		Config:    plugin.Config{"scheme": schemeCadvisor, "host_tags": false},
+	}}))
+	buf := &bytes.Buffer{}
+	if err := writePrometheus(buf, metrics); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP container_network_receive_bytes_total Cumulative count of bytes received
+# TYPE container_network_receive_bytes_total counter
+container_network_receive_bytes_total{container="cont",interface="eth0",namespace="ns",pod="pod"} 10
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,214 @@
+package cadvisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	// defaultRemoteURL is where a cAdvisor DaemonSet serves its API by default
+	defaultRemoteURL = "http://localhost:8080"
+	// defaultRemoteTimeout bounds a request to the remote cAdvisor
+	defaultRemoteTimeout = 10 * time.Second
+	// defaultRemoteRetries is how many times a failed request is retried
+	defaultRemoteRetries = 2
+)
+
+// remoteRetryDelay is the time to wait before every retry of a request, it
+// grows with the attempts
+var remoteRetryDelay = 500 * time.Millisecond
+
+// remoteOptions configures the remote source
+type remoteOptions struct {
+	// endpoints are the base URLs of the cAdvisor API, tried in order
+	endpoints []string
+	timeout   time.Duration
+	retries   int
+}
+
+// remoteOptionsOf reads the remote options set in cfg
+func remoteOptionsOf(cfg plugin.Config) remoteOptions {
+	options := remoteOptions{
+		timeout: time.Duration(getInt(cfg, "cadvisor_timeout", 0)) * time.Second,
+		retries: getInt(cfg, "cadvisor_retries", defaultRemoteRetries),
+	}
+	for _, endpoint := range strings.Split(getString(cfg, "cadvisor_url", defaultRemoteURL), ";") {
+		if endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/"); endpoint != "" {
+			options.endpoints = append(options.endpoints, endpoint)
+		}
+	}
+	if options.timeout <= 0 {
+		options.timeout = defaultRemoteTimeout
+	}
+	if options.retries < 0 {
+		options.retries = 0
+	}
+	return options
+}
+
+// remoteSource reads the containers of a standalone cAdvisor through its v2.0
+// REST API instead of embedding a cAdvisor manager. A failed request is
+// retried on every endpoint in turn.
+type remoteSource struct {
+	options remoteOptions
+	client  *http.Client
+}
+
+func newRemoteSource(options remoteOptions) (*remoteSource, error) {
+	if len(options.endpoints) == 0 {
+		return nil, fmt.Errorf("cadvisor_url is not set")
+	}
+	for _, endpoint := range options.endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cadvisor_url: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid cadvisor_url %q, expected an http or https URL", endpoint)
+		}
+	}
+	return &remoteSource{options: options, client: &http.Client{Timeout: options.timeout}}, nil
+}
+
+// Start is a no-op, the remote cAdvisor may start after the plugin and
+// requests are retried on every collection
+func (r *remoteSource) Start() error {
+	return nil
+}
+
+// GetContainerInfoV2 combines the stats and specs of the remote cAdvisor into
+// the container info the embedded manager returns
+func (r *remoteSource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	query := url.Values{}
+	query.Set("type", options.IdType)
+	query.Set("count", strconv.Itoa(options.Count))
+	query.Set("recursive", strconv.FormatBool(options.Recursive))
+	stats := map[string][]remoteStats{}
+	if err := r.get(path.Join("stats", containerName), query, &stats); err != nil {
+		return nil, err
+	}
+	query.Del("count")
+	specs := map[string]info.ContainerSpec{}
+	if err := r.get(path.Join("spec", containerName), query, &specs); err != nil {
+		return nil, err
+	}
+	containers := make(map[string]info.ContainerInfo, len(stats))
+	for name, samples := range stats {
+		spec, ok := specs[name]
+		if !ok {
+			// the container appeared between both requests
+			continue
+		}
+		cont := info.ContainerInfo{Spec: spec, Stats: make([]*info.ContainerStats, 0, len(samples))}
+		for _, s := range samples {
+			cont.Stats = append(cont.Stats, s.convert())
+		}
+		containers[name] = cont
+	}
+	return containers, nil
+}
+
+// GetMachineInfo returns the machine the remote cAdvisor runs on
+func (r *remoteSource) GetMachineInfo() (*v1.MachineInfo, error) {
+	machine := &v1.MachineInfo{}
+	if err := r.get("machine", nil, machine); err != nil {
+		return nil, err
+	}
+	return machine, nil
+}
+
+// get decodes the response of the API resource into out, trying every
+// endpoint in order and all of them again up to retries times
+func (r *remoteSource) get(resource string, query url.Values, out interface{}) error {
+	var err error
+	for attempt := 0; attempt <= r.options.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * remoteRetryDelay)
+		}
+		for _, endpoint := range r.options.endpoints {
+			if err = r.fetch(endpoint+"/api/v2.0/"+resource, query, out); err == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unable to get %s from cAdvisor after %d attempts: %v", resource, r.options.retries+1, err)
+}
+
+func (r *remoteSource) fetch(u string, query url.Values, out interface{}) error {
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	resp, err := r.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s responded with %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response of %s: %v", u, err)
+	}
+	return nil
+}
+
+// remoteStats is a sample as served by the stats resource of the v2.0 API,
+// which flags the stats it holds instead of leaving the others out
+type remoteStats struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	HasCpu        bool               `json:"has_cpu"`
+	Cpu           v1.CpuStats        `json:"cpu"`
+	CpuInst       *info.CpuInstStats `json:"cpu_inst"`
+	HasDiskIo     bool               `json:"has_diskio"`
+	DiskIo        v1.DiskIoStats     `json:"diskio"`
+	HasMemory     bool               `json:"has_memory"`
+	Memory        v1.MemoryStats     `json:"memory"`
+	HasNetwork    bool               `json:"has_network"`
+	Network       info.NetworkStats  `json:"network"`
+	HasFilesystem bool               `json:"has_filesystem"`
+	Filesystem    []remoteFs         `json:"filesystem"`
+}
+
+// remoteFs is the usage of a filesystem of a container
+type remoteFs struct {
+	Device    string `json:"device"`
+	Usage     uint64 `json:"usage"`
+	BaseUsage uint64 `json:"base_usage"`
+	Inodes    uint64 `json:"inodes"`
+}
+
+// convert returns the sample like the embedded manager does, the filesystem
+// is only known for containers on a single device
+func (s remoteStats) convert() *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: s.Timestamp}
+	if s.HasCpu {
+		stats.Cpu = &s.Cpu
+		stats.CpuInst = s.CpuInst
+	}
+	if s.HasDiskIo {
+		stats.DiskIo = &s.DiskIo
+	}
+	if s.HasMemory {
+		stats.Memory = &s.Memory
+	}
+	if s.HasNetwork {
+		stats.Network = &s.Network
+	}
+	if s.HasFilesystem && len(s.Filesystem) == 1 {
+		fs := s.Filesystem[0]
+		stats.Filesystem = &info.FilesystemStats{TotalUsageBytes: &fs.Usage, BaseUsageBytes: &fs.BaseUsage, InodeUsage: &fs.Inodes}
+	}
+	return stats
+}
@@ -0,0 +1,193 @@
+package cadvisor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// remoteStub stands in for the v2.0 API of cAdvisor with the responses of
+// testdata/remote, the first failures requests fail and every request waits
+// delay. It records the queries of the requests by resource.
+type remoteStub struct {
+	*httptest.Server
+	lock     sync.Mutex
+	failures int
+	delay    time.Duration
+	queries  map[string]url.Values
+}
+
+func newRemoteStub(t *testing.T) *remoteStub {
+	stub := &remoteStub{queries: map[string]url.Values{}}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.lock.Lock()
+		failing := stub.failures > 0
+		stub.failures--
+		stub.lock.Unlock()
+		time.Sleep(stub.delay)
+		if failing {
+			http.Error(w, "cAdvisor is starting", http.StatusServiceUnavailable)
+			return
+		}
+		resource := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/v2.0/"), "/", 2)[0]
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "remote", resource+".json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		stub.lock.Lock()
+		stub.queries[resource] = r.URL.Query()
+		stub.lock.Unlock()
+		w.Write(data)
+	}))
+	return stub
+}
+
+func TestRemoteSource(t *testing.T) {
+	stub := newRemoteStub(t)
+	defer stub.Close()
+	source, err := newRemoteSource(remoteOptionsOf(plugin.Config{"cadvisor_url": stub.URL + "/"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Start(); err != nil {
+		t.Fatal(err)
+	}
+	containers, err := source.GetContainerInfoV2("/", info.RequestOptions{Count: -1, Recursive: true, IdType: info.TypeName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := stub.queries["stats"]; stats.Get("count") != "-1" || stats.Get("type") != "name" || stats.Get("recursive") != "true" {
+		t.Errorf("unexpected stats query %v", stats)
+	}
+	if spec := stub.queries["spec"]; spec.Get("count") != "" || spec.Get("recursive") != "true" {
+		t.Errorf("unexpected spec query %v", spec)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("expected the root and a kubernetes container, got %d", len(containers))
+	}
+
+	cont := containers["/kubepods/burstable/pod1f2e3d4c/3c6a1f2e"]
+	if cont.Spec.Labels[KubernetesContainerNameLabel] != "nginx" || !cont.Spec.HasDiskIo || len(cont.Stats) != 2 {
+		t.Fatalf("unexpected container %+v", cont)
+	}
+	s := cont.Stats[1]
+	if !s.Timestamp.Equal(time.Unix(1500000000, 0)) || s.Cpu.Usage.Total != 2e9 || s.CpuInst.Usage.Total != 1e8 || s.Memory.WorkingSet != 16777218 {
+		t.Errorf("unexpected cpu and memory stats %+v %+v %+v", s.Cpu, s.CpuInst, s.Memory)
+	}
+	if s.Network.Interfaces[0].TxBytes != 4000 || s.Network.Tcp.Established != 3 || s.Network.Tcp6.Listen != 1 {
+		t.Errorf("unexpected network stats %+v", s.Network)
+	}
+	if s.DiskIo.IoServiced[0].Stats["Write"] != 4 {
+		t.Errorf("unexpected diskio stats %+v", s.DiskIo)
+	}
+	if *s.Filesystem.TotalUsageBytes != 40960 || *s.Filesystem.BaseUsageBytes != 32768 || *s.Filesystem.InodeUsage != 12 {
+		t.Errorf("unexpected filesystem stats %+v", s.Filesystem)
+	}
+	if cont.Stats[0].Cpu == cont.Stats[1].Cpu || cont.Stats[0].Cpu.Usage.Total != 1e9 {
+		t.Error("expected every sample to hold its own stats")
+	}
+	// like the embedded manager, filesystems are unknown for containers on several devices
+	if root := containers["/"]; root.Stats[0].Filesystem != nil || root.Stats[0].Cpu == nil {
+		t.Errorf("unexpected root stats %+v", root.Stats[0])
+	}
+
+	machine, err := source.GetMachineInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if machine.MachineID != "3f8c2b1a9d7e4c6b8a5f0e1d2c3b4a59" || machine.NumCores != 2 {
+		t.Errorf("unexpected machine %+v", machine)
+	}
+}
+
+func TestRemoteSourceRetries(t *testing.T) {
+	delay := remoteRetryDelay
+	remoteRetryDelay = 0
+	defer func() { remoteRetryDelay = delay }()
+	stub := newRemoteStub(t)
+	defer stub.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	get := func(cfg plugin.Config) error {
+		source, err := newRemoteSource(remoteOptionsOf(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = source.GetMachineInfo()
+		return err
+	}
+	stub.failures = 2
+	if err := get(plugin.Config{"cadvisor_url": stub.URL, "cadvisor_retries": int64(2)}); err != nil {
+		t.Errorf("expected the request to succeed on the last retry, got %v", err)
+	}
+	stub.failures = 1
+	if err := get(plugin.Config{"cadvisor_url": stub.URL, "cadvisor_retries": int64(0)}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the request to fail without retries, got %v", err)
+	}
+	if err := get(plugin.Config{"cadvisor_url": down.URL + ";" + stub.URL, "cadvisor_retries": int64(0)}); err != nil {
+		t.Errorf("expected the next endpoint to be tried, got %v", err)
+	}
+
+	stub.delay = 200 * time.Millisecond
+	options := remoteOptionsOf(plugin.Config{"cadvisor_url": stub.URL, "cadvisor_retries": int64(0)})
+	options.timeout = 20 * time.Millisecond
+	source, _ := newRemoteSource(options)
+	if _, err := source.GetContainerInfoV2("/", info.RequestOptions{Count: 1}); err == nil {
+		t.Error("expected the request to time out")
+	}
+
+	for _, endpoints := range []string{"", "localhost:8080", "http://localhost:8080;unix:///run/cadvisor.sock"} {
+		if _, err := newRemoteSource(remoteOptionsOf(plugin.Config{"cadvisor_url": endpoints})); err == nil {
+			t.Errorf("expected %q to be rejected", endpoints)
+		}
+	}
+}
+
+func TestRemoteSourceCollected(t *testing.T) {
+	stub := newRemoteStub(t)
+	defer stub.Close()
+
+	cfg := plugin.Config{"interval": int64(15), "source": sourceRemote, "cadvisor_url": stub.URL, "sysfs_root": filepath.Join("testdata", "sysfs")}
+	metrics, _ := (&Collector{}).GetMetricTypes(cfg)
+	requested := []plugin.Metric{}
+	for _, m := range metrics {
+		if m.Namespace.Element(2).Value == "container" {
+			requested = append(requested, m)
+		}
+	}
+	c := NewCollector()
+	polled, err := c.CollectMetrics(requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{}
+	for _, m := range polled {
+		if m.Tags["machine_id"] != "3f8c2b1a9d7e4c6b8a5f0e1d2c3b4a59" {
+			t.Errorf("%s: expected the machine id of the remote cAdvisor, got %v", m.Namespace.String(), m.Tags)
+		}
+		values[m.Namespace.String()] = m.Data
+	}
+	prefix := "/" + PluginVendor + "/" + PluginName + "/container/default/web-6d4cf56db6-x2x8k/nginx/"
+	for name, expected := range map[string]interface{}{
+		"cpu/total/usage":        uint64(2e9),
+		"iface/eth0/in_bytes":    uint64(2000),
+		"diskio/sda/write_bytes": uint64(16384),
+		"tcp/ESTABLISHED":        uint64(3),
+		"fs/base_usage":          uint64(32768),
+	} {
+		if values[prefix+name] != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, values[prefix+name])
+		}
+	}
+}
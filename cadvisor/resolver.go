@@ -0,0 +1,96 @@
+package cadvisor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolverMissTTL is how long a device sysfs does not know stays unknown
+// before it is looked up again, it may be a disk being attached
+const resolverMissTTL = time.Minute
+
+// deviceResolver names block devices after their kernel name, looked up in
+// <root>/dev/block/<major>:<minor>. Names found are cached for the lifetime of
+// the plugin, block device numbers are not reused while a device is present.
+// Devices that were not found are looked up again after resolverMissTTL.
+type deviceResolver struct {
+	root   string
+	lock   sync.Mutex
+	names  map[[2]uint64]string
+	misses map[[2]uint64]time.Time
+}
+
+var (
+	resolversLock sync.Mutex
+	resolvers     = map[string]*deviceResolver{}
+)
+
+// resolverFor returns the resolver of the sysfs tree at root, shared by every
+// task using the same root so lookups survive config updates
+func resolverFor(root string) *deviceResolver {
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+	r, ok := resolvers[root]
+	if !ok {
+		r = &deviceResolver{root: root, names: map[[2]uint64]string{}, misses: map[[2]uint64]time.Time{}}
+		resolvers[root] = r
+	}
+	return r
+}
+
+// name returns the kernel name of disk d, or <major>_<minor> when sysfs does not
+// know the device. The name cAdvisor reported is not used, it may be stale or
+// belong to another device with the same number.
+func (r *deviceResolver) name(d Device) string {
+	return r.nameAt(d, time.Now())
+}
+
+// nameAt names disk d at time now, looking it up unless its name is cached or
+// it was missing from sysfs less than resolverMissTTL ago
+func (r *deviceResolver) nameAt(d Device, now time.Time) string {
+	key := [2]uint64{d.Major, d.Minor}
+	r.lock.Lock()
+	name, ok := r.names[key]
+	missed, recent := r.misses[key]
+	recent = recent && now.Sub(missed) < resolverMissTTL
+	r.lock.Unlock()
+	if !ok && !recent {
+		name = r.lookup(d.Major, d.Minor)
+		r.lock.Lock()
+		if name != "" {
+			r.names[key] = name
+			delete(r.misses, key)
+		} else {
+			r.misses[key] = now
+		}
+		r.lock.Unlock()
+	}
+	if name == "" {
+		return fmt.Sprintf("%d_%d", d.Major, d.Minor)
+	}
+	return name
+}
+
+// lookup reads the kernel name of a block device from its uevent, or from the
+// target of its sysfs link. It is empty when sysfs does not know the device.
+func (r *deviceResolver) lookup(major, minor uint64) string {
+	path := filepath.Join(r.root, "dev", "block", fmt.Sprintf("%d:%d", major, minor))
+	if f, err := os.Open(filepath.Join(path, "uevent")); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if name := strings.TrimPrefix(scanner.Text(), "DEVNAME="); name != scanner.Text() {
+				return name
+			}
+		}
+	}
+	if target, err := os.Readlink(path); err == nil {
+		return filepath.Base(target)
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package cadvisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// fakeSysfs creates a sysfs tree knowing 8:0 through its uevent and 8:16
+// through its link only
+func fakeSysfs(t *testing.T) string {
+	root, err := ioutil.TempDir("", "cadvisor-sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := filepath.Join(root, "dev", "block")
+	if err := os.MkdirAll(filepath.Join(block, "8:0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(block, "8:0", "uevent"), []byte("MAJOR=8\nMINOR=0\nDEVNAME=sda\nDEVTYPE=disk\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../devices/pci0000:00/0000:00:01.1/host0/target0:0:0/0:0:0:0/block/sdb", filepath.Join(block, "8:16")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestDeviceResolver(t *testing.T) {
+	root := fakeSysfs(t)
+	defer os.RemoveAll(root)
+	r := resolverFor(root)
+	for _, tc := range []struct {
+		device   Device
+		expected string
+	}{
+		{device: Device{Major: 8, Minor: 0}, expected: "sda"},
+		{device: Device{Name: "ambiguous", Major: 8, Minor: 0}, expected: "sda"},
+		{device: Device{Major: 8, Minor: 16}, expected: "sdb"},
+		{device: Device{Name: "dm-0", Major: 253, Minor: 0}, expected: "253_0"},
+		{device: Device{Major: 253, Minor: 1}, expected: "253_1"},
+	} {
+		if name := r.name(tc.device); name != tc.expected {
+			t.Errorf("%d:%d named %q: expected %q, got %q", tc.device.Major, tc.device.Minor, tc.device.Name, tc.expected, name)
+		}
+	}
+	if resolverFor(root) != resolverFor(root) {
+		t.Error("expected the resolver of a root to be shared")
+	}
+}
+
+func TestDeviceResolverMisses(t *testing.T) {
+	root := fakeSysfs(t)
+	defer os.RemoveAll(root)
+	r := resolverFor(root)
+	start := time.Now()
+	disk := Device{Name: "nbd0", Major: 43, Minor: 0}
+	if name := r.nameAt(disk, start); name != "43_0" {
+		t.Fatalf("expected the device number of an unknown disk, got %q", name)
+	}
+	// the disk shows up in sysfs after the lookup
+	if err := os.Symlink("../../devices/virtual/block/nbd0p1", filepath.Join(root, "dev", "block", "43:0")); err != nil {
+		t.Fatal(err)
+	}
+	if name := r.nameAt(disk, start.Add(resolverMissTTL/2)); name != "43_0" {
+		t.Errorf("expected the miss to be cached, got %q", name)
+	}
+	if name := r.nameAt(disk, start.Add(resolverMissTTL)); name != "nbd0p1" {
+		t.Errorf("expected the disk to be looked up again, got %q", name)
+	}
+	if len(r.misses) != 0 {
+		t.Errorf("expected found disks to leave the misses, got %v", r.misses)
+	}
+}
+
+func TestDiskNamesAndTags(t *testing.T) {
+	root := fakeSysfs(t)
+	defer os.RemoveAll(root)
+	s := testStats()
+	s.DiskIo = &v1.DiskIoStats{IoServiceBytes: []v1.PerDiskStats{
+		{Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 1}},
+		{Major: 253, Minor: 3, Stats: map[string]uint64{"Read": 2}},
+	}}
+	for _, scheme := range []string{schemeSnap, schemeCadvisor} {
+		c := NewCollector()
+		c.mng = &fakeSource{stats: []*info.ContainerStats{s}}
+		requested := requestedMetrics(15, plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "read_bytes"))
+		requested[0].Config = plugin.Config{"sysfs_root": root, "scheme": scheme}
+		if scheme == schemeCadvisor {
+			requested[0].Namespace = plugin.NewNamespace("container_fs_reads_bytes_total")
+		}
+		metrics := c.collect(newSnapshot(requested))
+		if len(metrics) != 2 {
+			t.Fatalf("%s: expected 2 disks, got %v", scheme, metrics)
+		}
+		for i, expected := range []struct{ name, major, minor string }{{"sdb", "8", "16"}, {"253_3", "253", "3"}} {
+			m := metrics[i]
+			name := m.Tags["device"]
+			if scheme == schemeSnap {
+				name = m.Namespace.Element(familyIndex + 1).Value
+			}
+			if name != expected.name || m.Tags["major"] != expected.major || m.Tags["minor"] != expected.minor {
+				t.Errorf("%s: expected %s %s:%s, got %s %v", scheme, expected.name, expected.major, expected.minor, name, m.Tags)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cadvisor
+
+import (
+	"sort"
+	"sync"
+
+	info "github.com/google/cadvisor/info/v2"
+)
+
+// sampleTracker remembers the last sample emitted for every container so
+// samples cAdvisor has not refreshed since are not emitted twice, and metrics
+// derived between samples can start from it
+type sampleTracker struct {
+	lock sync.Mutex
+	last map[string]*info.ContainerStats
+	seen map[string]*info.ContainerStats
+}
+
+func newSampleTracker() *sampleTracker {
+	return &sampleTracker{
+		last: map[string]*info.ContainerStats{},
+		seen: map[string]*info.ContainerStats{},
+	}
+}
+
+// fresh returns the samples of the named container that were not emitted yet,
+// oldest first. Only the newest sample is considered unless all is set, and a
+// container seen for the first time never backfills its history.
+func (t *sampleTracker) fresh(name string, stats []*info.ContainerStats, all bool) []*info.ContainerStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	last, known := t.last[name]
+	newest := last
+	latest := -1
+	var out []*info.ContainerStats
+	for i, s := range stats {
+		if newest == nil || s.Timestamp.After(newest.Timestamp) {
+			newest = s
+			latest = i
+		}
+		if all && known && s.Timestamp.After(last.Timestamp) {
+			out = append(out, s)
+		}
+	}
+	t.seen[name] = newest
+	if latest < 0 {
+		return nil
+	}
+	if !all || !known {
+		return stats[latest : latest+1]
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
+
+// previous returns the last sample emitted for the named container by the
+// previous collections, nil for a container seen for the first time
+func (t *sampleTracker) previous(name string) *info.ContainerStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.last[name]
+}
+
+// keep carries the state of the named container over to the next collection
+// without emitting any of its samples, for containers a collection skipped
+func (t *sampleTracker) keep(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if last, ok := t.last[name]; ok {
+		t.seen[name] = last
+	} else {
+		delete(t.seen, name)
+	}
+}
+
+// commit forgets the containers that were not part of the last collection
+func (t *sampleTracker) commit() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.last = t.seen
+	t.seen = make(map[string]*info.ContainerStats, len(t.last))
+}
+
+// reset makes the next collection emit the newest sample of every container again
+func (t *sampleTracker) reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.last = map[string]*info.ContainerStats{}
+	t.seen = map[string]*info.ContainerStats{}
+}
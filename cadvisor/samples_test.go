@@ -0,0 +1,40 @@
+package cadvisor
+
+import (
+	"testing"
+)
+
+func TestSampleTrackerForgetsRemovedContainers(t *testing.T) {
+	tracker := newSampleTracker()
+	tracker.fresh("a", statsAt(10), false)
+	tracker.fresh("b", statsAt(10), false)
+	tracker.commit()
+	tracker.fresh("a", statsAt(10), false)
+	tracker.commit()
+	if _, ok := tracker.last["b"]; ok {
+		t.Error("container b was not forgotten after it disappeared")
+	}
+	if out := tracker.fresh("a", statsAt(10), false); len(out) != 0 {
+		t.Errorf("expected sample of a to stay suppressed, got %d samples", len(out))
+	}
+}
+
+func TestSampleTrackerReset(t *testing.T) {
+	tracker := newSampleTracker()
+	tracker.fresh("a", statsAt(10), true)
+	tracker.commit()
+	tracker.reset()
+	if out := tracker.fresh("a", statsAt(5, 10), true); len(out) != 1 || out[0].Timestamp.Unix() != 10 {
+		t.Errorf("expected only the latest sample after a reset, got %v", out)
+	}
+}
+
+func TestSampleTrackerUnorderedSamples(t *testing.T) {
+	tracker := newSampleTracker()
+	tracker.fresh("a", statsAt(10), true)
+	tracker.commit()
+	out := tracker.fresh("a", statsAt(40, 20, 30), true)
+	if len(out) != 3 || out[0].Timestamp.Unix() != 20 || out[2].Timestamp.Unix() != 40 {
+		t.Errorf("expected samples ordered by timestamp, got %v", out)
+	}
+}
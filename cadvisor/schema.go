@@ -0,0 +1,162 @@
+package cadvisor
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// Namespace schema versions selectable through the "schema_version" config,
+// they only change the names of the snap scheme
+const (
+	// schemaV1 is the layout the METRICS.md of the first releases documented,
+	// with camel case filesystem metrics and rx/tx interface metrics. Those
+	// releases emitted the names of schemaV2 regardless
+	schemaV1 = 1
+	// schemaV2 names every metric in snake case, interfaces in/out
+	schemaV2 = 2
+	// currentSchema is the layout of the registry
+	currentSchema = schemaV2
+)
+
+// schemaRenames holds the metrics every schema version renamed, keyed by
+// family and path in that version, with their path in the previous version.
+// Renaming a metric requires a new version listing its previous path here.
+var schemaRenames = map[int]map[string][]string{
+	schemaV2: {
+		"fs/base_usage":     {"baseUsage"},
+		"fs/inode_usage":    {"inodeUsage"},
+		"fs/total_usage":    {"totalUsage"},
+		"iface/in_bytes":    {"rx_bytes"},
+		"iface/in_packets":  {"rx_packets"},
+		"iface/in_errors":   {"rx_errors"},
+		"iface/in_dropped":  {"rx_dropped"},
+		"iface/out_bytes":   {"tx_bytes"},
+		"iface/out_packets": {"tx_packets"},
+		"iface/out_errors":  {"tx_errors"},
+		"iface/out_dropped": {"tx_dropped"},
+	},
+}
+
+// schemaOf returns the schema version set in cfg
+func schemaOf(cfg plugin.Config) int {
+	version := getInt(cfg, "schema_version", currentSchema)
+	if version < schemaV1 || version > currentSchema {
+		log.Printf("unknown schema version %d, using %d\n", version, currentSchema)
+		return currentSchema
+	}
+	return version
+}
+
+// pathIn returns the path of m in schema version
+func pathIn(m *Metric, version int) []string {
+	path := m.Path
+	for v := currentSchema; v > version; v-- {
+		if previous, ok := schemaRenames[v][m.Family+"/"+strings.Join(path, "/")]; ok {
+			path = previous
+		}
+	}
+	return path
+}
+
+var (
+	schemasLock sync.Mutex
+	schemas     = map[int][]*Metric{}
+)
+
+// registryFor returns the registry named as in schema version, in registry
+// order. Metrics keep their entry unless the version names them differently.
+func registryFor(version int) []*Metric {
+	if version == currentSchema {
+		return registry
+	}
+	schemasLock.Lock()
+	defer schemasLock.Unlock()
+	if metrics, ok := schemas[version]; ok {
+		return metrics
+	}
+	metrics := make([]*Metric, len(registry))
+	for i, m := range registry {
+		metrics[i] = m
+		if path := pathIn(m, version); !reflect.DeepEqual(path, m.Path) {
+			renamed := *m
+			renamed.Path = path
+			renamed.origin = m
+			metrics[i] = &renamed
+		}
+	}
+	schemas[version] = metrics
+	return metrics
+}
+
+// versioned returns registry metric m named as in schema version
+func versioned(m *Metric, version int) *Metric {
+	metrics := registryFor(version)
+	for i, current := range registry {
+		if current == m {
+			return metrics[i]
+		}
+	}
+	return m
+}
+
+// alias maps the path of a metric in an older schema version to its current one
+type alias struct {
+	family    string
+	perDevice bool
+	old       []string
+	current   []string
+}
+
+// aliases holds the older paths of every renamed metric
+var aliases = schemaAliases()
+
+func schemaAliases() []alias {
+	list := []alias{}
+	seen := map[string]bool{}
+	for version := schemaV1; version < currentSchema; version++ {
+		for _, m := range registry {
+			old := pathIn(m, version)
+			key := m.Family + "/" + strings.Join(old, "/")
+			if reflect.DeepEqual(old, m.Path) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			list = append(list, alias{family: m.Family, perDevice: m.PerDevice(), old: old, current: m.Path})
+		}
+	}
+	return list
+}
+
+// canonical rewrites a namespace requested with the names of an older
+// schema version to the current names, other namespaces are returned as is.
+// Summaries keep their aggregation leaf.
+func canonical(ns plugin.Namespace) plugin.Namespace {
+	if len(ns) <= familyIndex {
+		return ns
+	}
+	family := ns.Element(familyIndex).Value
+	for _, a := range aliases {
+		offset := familyIndex + 1
+		if a.perDevice {
+			offset++
+		}
+		if a.family != family || len(ns) < offset+len(a.old) {
+			continue
+		}
+		matches := true
+		for i, p := range a.old {
+			matches = matches && ns.Element(offset+i).Value == p
+		}
+		if !matches {
+			continue
+		}
+		renamed := append(plugin.Namespace{}, ns[:offset]...)
+		renamed = renamed.AddStaticElements(a.current...)
+		return append(renamed, ns[offset+len(a.old):]...)
+	}
+	return ns
+}
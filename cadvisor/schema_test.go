@@ -0,0 +1,131 @@
+package cadvisor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func TestCanonical(t *testing.T) {
+	prefix := []string{PluginVendor, PluginName, "container", "*", "*", "*"}
+	for _, c := range []struct{ requested, expected []string }{
+		{[]string{"iface", "*", "rx_bytes"}, []string{"iface", "*", "in_bytes"}},
+		{[]string{"iface", "eth0", "tx_dropped"}, []string{"iface", "eth0", "out_dropped"}},
+		{[]string{"fs", "baseUsage"}, []string{"fs", "base_usage"}},
+		// summaries keep their aggregation
+		{[]string{"fs", "totalUsage", "max"}, []string{"fs", "total_usage", "max"}},
+		// current and unknown names are left alone
+		{[]string{"fs", "base_usage"}, []string{"fs", "base_usage"}},
+		{[]string{"iface", "rx_bytes"}, []string{"iface", "rx_bytes"}},
+		{[]string{"mem", "usage"}, []string{"mem", "usage"}},
+	} {
+		got := canonical(plugin.NewNamespace(append(prefix, c.requested...)...))
+		if expected := plugin.NewNamespace(append(prefix, c.expected...)...); got.String() != expected.String() {
+			t.Errorf("%v: expected %s, got %s", c.requested, expected.String(), got.String())
+		}
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	for _, c := range []struct {
+		cfg      plugin.Config
+		expected int
+	}{
+		{plugin.Config{}, currentSchema},
+		{plugin.Config{"schema_version": int64(1)}, schemaV1},
+		{plugin.Config{"schema_version": int64(0)}, currentSchema},
+		{plugin.Config{"schema_version": int64(currentSchema + 1)}, currentSchema},
+	} {
+		if got := schemaOf(c.cfg); got != c.expected {
+			t.Errorf("%v: expected schema %d, got %d", c.cfg, c.expected, got)
+		}
+	}
+}
+
+func TestSchemaCatalog(t *testing.T) {
+	current, old := catalog(schemeSnap, currentSchema, nil), catalog(schemeSnap, schemaV1, nil)
+	if len(current) != len(old) {
+		t.Fatalf("expected the same catalog size in every version, got %d and %d", len(current), len(old))
+	}
+	names := map[string]bool{}
+	for _, m := range old {
+		names[m.Namespace.String()] = true
+	}
+	prefix := containerNamespace("*", "*", "*").String() + "/"
+	for _, name := range []string{"fs/baseUsage", "iface/*/rx_bytes", "iface/*/tx_errors", "mem/usage"} {
+		if !names[prefix+name] {
+			t.Errorf("expected %s in the version 1 catalog", name)
+		}
+	}
+	if names[prefix+"fs/base_usage"] || names[prefix+"iface/*/in_bytes"] {
+		t.Error("expected no current names in the version 1 catalog")
+	}
+	// the current schema is the registry itself
+	if len(registryFor(currentSchema)) != len(registry) || registryFor(schemaV1)[0] != registry[0] {
+		t.Error("expected metrics that were not renamed to keep their registry entry")
+	}
+}
+
+func TestSchemaCollected(t *testing.T) {
+	request := func(cfg plugin.Config, names ...string) []plugin.Metric {
+		metrics := []plugin.Metric{}
+		for _, name := range names {
+			ns := containerNamespace("*", "*", "*")
+			metrics = append(metrics, plugin.Metric{Namespace: ns.AddStaticElements(strings.Split(name, "/")...), Config: cfg})
+		}
+		return metrics
+	}
+	for _, c := range []struct {
+		name     string
+		cfg      plugin.Config
+		expected []string
+	}{
+		{"current schema", plugin.Config{"interval": int64(15)}, []string{"fs/base_usage", "iface/eth0/in_bytes"}},
+		{"version 1", plugin.Config{"interval": int64(15), "schema_version": int64(1)}, []string{"fs/baseUsage", "iface/eth0/rx_bytes"}},
+	} {
+		c.cfg["stats"] = "fs:max"
+		config := newSnapshot(request(c.cfg, "fs/baseUsage", "iface/*/rx_bytes", "fs/baseUsage/max"))
+		col := NewCollector()
+		col.mng = &fakeSource{}
+		emitted := map[string]bool{}
+		prefix := containerNamespace("ns", "pod", "cont").String() + "/"
+		for _, m := range col.collect(config) {
+			emitted[m.Namespace.String()[len(prefix):]] = true
+		}
+		for _, name := range c.expected {
+			if !emitted[name] {
+				t.Errorf("%s: expected %s to be emitted, got %v", c.name, name, emitted)
+			}
+		}
+		if len(config.manifest.stats) != 1 || config.manifest.stats[0].metric.Path[0] != strings.Split(c.expected[0], "/")[1] {
+			t.Errorf("%s: expected the summary of %s, got %v", c.name, c.expected[0], config.manifest.stats)
+		}
+	}
+}
+
+func TestFirstReleaseNames(t *testing.T) {
+	// names emitted by the first releases, whatever their METRICS.md said
+	names := []string{"fs/base_usage", "fs/total_usage", "iface/*/in_bytes", "iface/*/out_errors", "diskio/*/read_bytes"}
+	metrics := []plugin.Metric{}
+	for _, name := range names {
+		ns := containerNamespace("*", "*", "*").AddStaticElements(strings.Split(name, "/")...)
+		if _, ok := lookupMetric(canonical(ns)); !ok {
+			t.Errorf("%s does not resolve to a metric", name)
+		}
+		metrics = append(metrics, plugin.Metric{Namespace: ns, Config: plugin.Config{"interval": int64(15), "sysfs_root": filepath.Join("testdata", "sysfs")}})
+	}
+	col := NewCollector()
+	col.mng = &fakeSource{}
+	emitted := map[string]bool{}
+	prefix := containerNamespace("ns", "pod", "cont").String() + "/"
+	for _, m := range col.collect(newSnapshot(metrics)) {
+		emitted[m.Namespace.String()[len(prefix):]] = true
+	}
+	for _, name := range []string{"fs/base_usage", "fs/total_usage", "iface/eth0/in_bytes", "iface/eth0/out_errors", "diskio/sda/read_bytes"} {
+		if !emitted[name] {
+			t.Errorf("expected %s to be emitted under the default schema, got %v", name, emitted)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package cadvisor
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// selfStats holds the counters the plugin keeps about its own operation,
+// fields are updated and read atomically
+type selfStats struct {
+	overruns     uint64
+	skippedTicks uint64
+	timeouts     uint64
+	// droppedSeries counts the series dropped by the series limits
+	droppedSeries uint64
+	// caps holds the *capabilities of the host last collected from
+	caps atomic.Value
+}
+
+// probed returns the capabilities of the host last collected from, nil when
+// it was not probed
+func (s *selfStats) probed() *capabilities {
+	caps, _ := s.caps.Load().(*capabilities)
+	return caps
+}
+
+// capabilityMetric reports whether the named check of the capability probe passed
+func capabilityMetric(check string, description string) *SelfMetric {
+	return &SelfMetric{
+		Path: []string{"capabilities", check}, Unit: "bool", Kind: Gauge,
+		Description: description + ", 1 when available",
+		Data: func(s *selfStats) interface{} {
+			if s.probed().available(check) {
+				return uint64(1)
+			}
+			return uint64(0)
+		},
+	}
+}
+
+// SelfMetric declares a metric describing the plugin itself rather than a container
+type SelfMetric struct {
+	Path        []string
+	Unit        string
+	Description string
+	Kind        Kind
+	Data        func(s *selfStats) interface{}
+}
+
+// Namespace returns the namespace of the self metric
+func (m *SelfMetric) Namespace() plugin.Namespace {
+	return plugin.NewNamespace(PluginVendor, PluginName, "plugin").AddStaticElements(m.Path...)
+}
+
+// lookupSelfMetric finds the self metric a requested namespace refers to
+func lookupSelfMetric(ns plugin.Namespace) (*SelfMetric, bool) {
+	for _, m := range selfRegistry {
+		if ns.String() == m.Namespace().String() {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// convert appends the requested self metrics to metrics
+func (s *selfStats) convert(metrics []plugin.Metric, requested []*SelfMetric, now time.Time) []plugin.Metric {
+	for _, m := range requested {
+		metrics = append(metrics, plugin.Metric{
+			Namespace:   m.Namespace(),
+			Description: m.Description,
+			Unit:        m.Unit,
+			Data:        m.Data(s),
+			Timestamp:   now,
+		})
+	}
+	return metrics
+}
+
+// selfRegistry holds every metric the plugin reports about itself
+var selfRegistry = []*SelfMetric{
+	{
+		Path: []string{"scheduler", "overruns"}, Unit: "event", Kind: Counter,
+		Description: "Number of emissions that did not complete before the next aligned interval boundary",
+		Data:        func(s *selfStats) interface{} { return atomic.LoadUint64(&s.overruns) },
+	},
+	{
+		Path: []string{"scheduler", "skipped_ticks"}, Unit: "event", Kind: Counter,
+		Description: "Number of aligned interval boundaries skipped because of overruns",
+		Data:        func(s *selfStats) interface{} { return atomic.LoadUint64(&s.skippedTicks) },
+	},
+	{
+		Path: []string{"collector", "timeouts"}, Unit: "event", Kind: Counter,
+		Description: "Number of collections that reached the collection timeout and emitted the containers converted so far",
+		Data:        func(s *selfStats) interface{} { return atomic.LoadUint64(&s.timeouts) },
+	},
+	{
+		Path: []string{"limits", "dropped_series"}, Unit: "series", Kind: Counter,
+		Description: "Number of series dropped because of the max_series and max_devices limits",
+		Data:        func(s *selfStats) interface{} { return atomic.LoadUint64(&s.droppedSeries) },
+	},
+	capabilityMetric("cgroup_cpu", "Whether the cpuacct cgroups can be read"),
+	capabilityMetric("cgroup_memory", "Whether the memory cgroups can be read"),
+	capabilityMetric("cgroup_blkio", "Whether the blkio cgroups can be read"),
+	capabilityMetric("net_dev", "Whether the interface stats of processes can be read"),
+	capabilityMetric("tcp", "Whether the tcp connections of processes can be read"),
+	capabilityMetric("tcp6", "Whether the tcp6 connections of processes can be read"),
+	capabilityMetric("docker", "Whether the Docker socket is reachable"),
+	capabilityMetric("containerd", "Whether the containerd socket is reachable"),
+	{
+		Path: []string{"capabilities", "disabled_families"}, Unit: "family", Kind: Gauge,
+		Description: "Number of metric families disabled because the capability probe found they cannot be collected",
+		Data: func(s *selfStats) interface{} {
+			if caps := s.probed(); caps != nil {
+				return uint64(len(caps.disabled))
+			}
+			return uint64(0)
+		},
+	},
+}
@@ -0,0 +1,152 @@
+package cadvisor
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// seriesKey identifies a series of a container, summaries by their aggregation
+type seriesKey struct {
+	metric      *Metric
+	device      Device
+	aggregation *Aggregation
+}
+
+// seriesName is the namespace and tags a series is emitted with
+type seriesName struct {
+	namespace plugin.Namespace
+	tags      map[string]string
+}
+
+// containerSeries caches the names of the series of a container, so the
+// namespaces and tags are only built once for as long as the container lives.
+// The cached tags include the global tags. Emitted metrics share the cached
+// namespaces and tags, which must not be modified.
+type containerSeries struct {
+	contInfo [3]string
+	scheme   string
+	// global are the global tags the series are tagged with, of the tagging
+	// of the cache
+	global  map[string]string
+	tagging uint64
+	lock    sync.Mutex
+	names   map[seriesKey]seriesName
+	// generation is the last collection that used the container
+	generation uint64
+}
+
+func newContainerSeries(contInfo [3]string, scheme string) *containerSeries {
+	return &containerSeries{
+		contInfo: contInfo,
+		scheme:   scheme,
+		names:    map[seriesKey]seriesName{},
+	}
+}
+
+// name returns the namespace and tags of metric m for device d
+func (s *containerSeries) name(m *Metric, d Device) seriesName {
+	key := seriesKey{metric: m, device: d}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if name, ok := s.names[key]; ok {
+		return name
+	}
+	var name seriesName
+	if s.scheme == schemeCadvisor {
+		name = seriesName{namespace: m.CompatNamespace(), tags: m.compatTags(s.contInfo, d)}
+	} else {
+		name = seriesName{namespace: m.Namespace(s.contInfo[0], s.contInfo[1], s.contInfo[2], d.Name)}
+	}
+	name.tags = mergeTags(s.global, m.deviceTags(name.tags, d))
+	s.names[key] = name
+	return name
+}
+
+// summary returns the namespace and tags of the summary r for device d
+func (s *containerSeries) summary(r statRequest, d Device) seriesName {
+	key := seriesKey{metric: r.metric, device: d, aggregation: r.aggregation}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if name, ok := s.names[key]; ok {
+		return name
+	}
+	var name seriesName
+	if s.scheme == schemeCadvisor {
+		name = seriesName{namespace: plugin.NewNamespace(r.CompatName()), tags: r.metric.compatTags(s.contInfo, d)}
+	} else {
+		name = seriesName{namespace: r.Namespace(s.contInfo[0], s.contInfo[1], s.contInfo[2], d.Name)}
+	}
+	name.tags = mergeTags(s.global, r.metric.deviceTags(name.tags, d))
+	s.names[key] = name
+	return name
+}
+
+// deviceTags adds the tags identifying device d of metric m to tags: disks
+// keep their device numbers, names may be ambiguous
+func (m *Metric) deviceTags(tags map[string]string, d Device) map[string]string {
+	if m.Family != "diskio" {
+		return tags
+	}
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	tags["major"] = strconv.FormatUint(d.Major, 10)
+	tags["minor"] = strconv.FormatUint(d.Minor, 10)
+	return tags
+}
+
+// seriesCache holds the containerSeries of every container collected by the
+// last collections, containers that vanished are dropped by sweep
+type seriesCache struct {
+	lock       sync.Mutex
+	containers map[string]*containerSeries
+	generation uint64
+	// tags are the global tags of the current collection, tagging counts
+	// their changes so the series of every container are rebuilt
+	tags    map[string]string
+	tagging uint64
+}
+
+func newSeriesCache() *seriesCache {
+	return &seriesCache{containers: map[string]*containerSeries{}}
+}
+
+// begin starts a collection whose series are tagged with the global tags,
+// containers it does not use are dropped by the next sweep
+func (c *seriesCache) begin(tags map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	if !sameTags(c.tags, tags) {
+		c.tags = tags
+		c.tagging++
+	}
+}
+
+// container returns the series of the named container, rebuilding them when
+// its labels, the scheme or the global tags changed
+func (c *seriesCache) container(name string, contInfo [3]string, scheme string) *containerSeries {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	series, ok := c.containers[name]
+	if !ok || series.contInfo != contInfo || series.scheme != scheme || series.tagging != c.tagging {
+		series = newContainerSeries(contInfo, scheme)
+		series.global, series.tagging = c.tags, c.tagging
+		c.containers[name] = series
+	}
+	series.generation = c.generation
+	return series
+}
+
+// sweep drops the containers the current collection did not use
+func (c *seriesCache) sweep() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for name, series := range c.containers {
+		if series.generation < c.generation {
+			delete(c.containers, name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cadvisor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func TestSeriesCache(t *testing.T) {
+	cache := newSeriesCache()
+	contInfo := [3]string{"ns", "pod", "cont"}
+	iface := registry[len(registry)-1]
+
+	cache.begin(nil)
+	series := cache.container("/kubepods/pod1/cont1", contInfo, schemeSnap)
+	eth0 := series.name(iface, Device{Name: "eth0"})
+	if eth0.namespace.String() != iface.Namespace("ns", "pod", "cont", "eth0").String() {
+		t.Errorf("unexpected namespace %s", eth0.namespace.String())
+	}
+	if again := series.name(iface, Device{Name: "eth0"}); &again.namespace[0] != &eth0.namespace[0] {
+		t.Error("expected the cached namespace to be reused")
+	}
+	if eth1 := series.name(iface, Device{Name: "eth1"}); eth1.namespace.Element(familyIndex+1).Value != "eth1" {
+		t.Errorf("expected a namespace per device, got %s", eth1.namespace.String())
+	}
+	cache.sweep()
+
+	cache.begin(nil)
+	if cache.container("/kubepods/pod1/cont1", contInfo, schemeSnap) != series {
+		t.Error("expected the series of a live container to be kept")
+	}
+	compat := cache.container("/kubepods/pod1/cont1", contInfo, schemeCadvisor)
+	if compat == series {
+		t.Error("expected the series to be rebuilt for another scheme")
+	}
+	if tags := compat.name(iface, Device{Name: "eth0"}).tags; tags["interface"] != "eth0" || tags["pod"] != "pod" {
+		t.Errorf("unexpected cadvisor scheme tags %v", tags)
+	}
+	cache.sweep()
+
+	cache.begin(nil)
+	cache.sweep()
+	if len(cache.containers) != 0 {
+		t.Errorf("expected vanished containers to be dropped, got %d", len(cache.containers))
+	}
+}
+
+func TestSeriesCacheTags(t *testing.T) {
+	cache := newSeriesCache()
+	contInfo := [3]string{"ns", "pod", "cont"}
+	iface := registry[len(registry)-1]
+
+	cache.begin(map[string]string{"host": "node1"})
+	series := cache.container("/kubepods/pod1/cont1", contInfo, schemeCadvisor)
+	tags := series.name(iface, Device{Name: "eth0"}).tags
+	if tags["host"] != "node1" || tags["interface"] != "eth0" {
+		t.Errorf("expected the global and series tags, got %v", tags)
+	}
+	if snap := newContainerSeries(contInfo, schemeSnap); snap.name(iface, Device{Name: "eth0"}).tags != nil {
+		t.Error("expected no tags without global tags in the snap scheme")
+	}
+	cache.sweep()
+
+	// equal tags of the next collection keep the series
+	cache.begin(map[string]string{"host": "node1"})
+	if cache.container("/kubepods/pod1/cont1", contInfo, schemeCadvisor) != series {
+		t.Error("expected the series to be kept with the same global tags")
+	}
+	cache.sweep()
+
+	cache.begin(map[string]string{"host": "node2"})
+	if renamed := cache.container("/kubepods/pod1/cont1", contInfo, schemeCadvisor); renamed == series || renamed.name(iface, Device{Name: "eth0"}).tags["host"] != "node2" {
+		t.Error("expected the series to be rebuilt with the new global tags")
+	}
+}
+
+// BenchmarkConvert converts every registry metric of a sample into a reused
+// batch, with namespaces built from scratch or taken from the series cache
+func BenchmarkConvert(b *testing.B) {
+	stats := testStats()
+	contInfo := [3]string{"ns", "pod", "cont"}
+	for _, scheme := range []string{schemeSnap, schemeCadvisor} {
+		for _, cached := range []bool{false, true} {
+			b.Run(fmt.Sprintf("scheme=%s/cached=%v", scheme, cached), func(b *testing.B) {
+				series := newContainerSeries(contInfo, scheme)
+				metrics := make([]plugin.Metric, 0, len(registry))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if !cached {
+						series = newContainerSeries(contInfo, scheme)
+					}
+					metrics = metrics[:0]
+					for _, m := range registry {
+						metrics = m.convert(metrics, series, nil, stats, nil)
+					}
+				}
+			})
+		}
+	}
+}
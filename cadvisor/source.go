@@ -0,0 +1,207 @@
+package cadvisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+)
+
+// containerSource provides the container info the collector converts into
+// metrics, it is satisfied by cAdvisor's manager.Manager
+type containerSource interface {
+	Start() error
+	GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error)
+}
+
+// Container sources selectable through the "source" config
+const (
+	// sourceCadvisor embeds a cAdvisor container manager
+	sourceCadvisor = "cadvisor"
+	// sourceReplay replays collections recorded to replay_dir
+	sourceReplay = "replay"
+	// sourceSynthetic generates a node of synthetic_containers containers
+	sourceSynthetic = "synthetic"
+	// sourceKubelet polls the stats summary of the kubelet
+	sourceKubelet = "kubelet"
+	// sourceRemote reads a standalone cAdvisor through its REST API
+	sourceRemote = "remote"
+	// sourceCgroupfs reads the cgroup v1 controllers of the host directly
+	sourceCgroupfs = "cgroupfs"
+)
+
+var sources = []string{sourceCadvisor, sourceReplay, sourceSynthetic, sourceKubelet, sourceRemote, sourceCgroupfs}
+
+// newSource creates the container source selected by config, recording every
+// collection to config.recordDir when set
+func newSource(config *snapshot) (containerSource, error) {
+	var source containerSource
+	var err error
+	switch config.source {
+	case sourceCadvisor:
+		source, err = newManager(config.host, config.history())
+	case sourceReplay:
+		source, err = newReplaySource(config.replayDir)
+	case sourceSynthetic:
+		source, err = newSyntheticSource(config.synthetic)
+	case sourceKubelet:
+		source, err = newKubeletSource(config.kubelet)
+	case sourceRemote:
+		source, err = newRemoteSource(config.remote)
+	case sourceCgroupfs:
+		source, err = newCgroupfsSource(config.host)
+	default:
+		err = fmt.Errorf("unknown source %q", config.source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.recordDir != "" {
+		return newRecordingSource(source, config.recordDir), nil
+	}
+	return source, nil
+}
+
+// capabilitiesOf returns what the named source can collect, the host of the
+// cadvisor and cgroupfs sources is probed and the other sources collect
+// every family unless they never report it
+func capabilitiesOf(source string, host hostPaths) *capabilities {
+	switch source {
+	case sourceCadvisor:
+		return probeHost(host)
+	case sourceKubelet:
+		return kubeletCapabilities()
+	case sourceCgroupfs:
+		return cgroupfsCapabilities(host)
+	}
+	return nil
+}
+
+// recordingSource writes every collection of the wrapped source to a numbered
+// JSON file in dir, the files can be replayed with replaySource. Every call
+// is recorded, so only collections may call it.
+type recordingSource struct {
+	containerSource
+	dir  string
+	lock sync.Mutex
+	next int
+}
+
+func newRecordingSource(source containerSource, dir string) *recordingSource {
+	return &recordingSource{containerSource: source, dir: dir}
+}
+
+// Start starts the wrapped source and continues the numbering of existing recordings
+func (r *recordingSource) Start() error {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	existing, err := recordings(r.dir)
+	if err != nil {
+		return err
+	}
+	r.next = len(existing) + 1
+	return r.containerSource.Start()
+}
+
+// GetMachineInfo returns the machine of the wrapped source, or an unknown
+// machine when the wrapped source does not know it
+func (r *recordingSource) GetMachineInfo() (*v1.MachineInfo, error) {
+	if machines, ok := r.containerSource.(machineSource); ok {
+		return machines.GetMachineInfo()
+	}
+	return &v1.MachineInfo{}, nil
+}
+
+// GetContainerInfoV2 returns the collection of the wrapped source after recording it
+func (r *recordingSource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	containers, err := r.containerSource.GetContainerInfoV2(containerName, options)
+	if err != nil {
+		return containers, err
+	}
+	data, err := json.MarshalIndent(containers, "", "  ")
+	if err != nil {
+		return containers, fmt.Errorf("unable to record collection: %v", err)
+	}
+	r.lock.Lock()
+	name := filepath.Join(r.dir, fmt.Sprintf("%06d.json", r.next))
+	r.next++
+	r.lock.Unlock()
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		return containers, fmt.Errorf("unable to record collection: %v", err)
+	}
+	return containers, nil
+}
+
+// replaySource serves the collections recorded in dir in order, once all of
+// them were served it keeps serving the last one
+type replaySource struct {
+	dir         string
+	lock        sync.Mutex
+	collections []map[string]info.ContainerInfo
+	next        int
+}
+
+func newReplaySource(dir string) (*replaySource, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("replay_dir is not set")
+	}
+	return &replaySource{dir: dir}, nil
+}
+
+// Start loads every recording of dir
+func (r *replaySource) Start() error {
+	files, err := recordings(r.dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no recordings found in %s", r.dir)
+	}
+	collections := make([]map[string]info.ContainerInfo, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		containers := map[string]info.ContainerInfo{}
+		if err := json.Unmarshal(data, &containers); err != nil {
+			return fmt.Errorf("invalid recording %s: %v", file, err)
+		}
+		collections = append(collections, containers)
+	}
+	r.lock.Lock()
+	r.collections = collections
+	r.lock.Unlock()
+	return nil
+}
+
+// GetContainerInfoV2 returns the next recorded collection
+func (r *replaySource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.collections) == 0 {
+		return nil, fmt.Errorf("replay source is not started")
+	}
+	containers := r.collections[r.next]
+	if r.next < len(r.collections)-1 {
+		r.next++
+	}
+	return containers, nil
+}
+
+// recordings lists the recorded collections of dir in order
+func recordings(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,192 @@
+package cadvisor
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the replay tests")
+
+// requestAll requests every registry metric with cfg
+func requestAll(cfg plugin.Config) []plugin.Metric {
+	metrics := []plugin.Metric{}
+	for _, m := range registry {
+		metrics = append(metrics, plugin.Metric{
+			Namespace: m.Namespace("*", "*", "*", "*"),
+			Config:    cfg,
+		})
+	}
+	return metrics
+}
+
+// replayMetrics requests every registry metric from the recordings in dir
+func replayMetrics(dir string) []plugin.Metric {
+	return requestAll(plugin.Config{
+		"interval":   int64(15),
+		"source":     sourceReplay,
+		"replay_dir": dir,
+		"sysfs_root": filepath.Join("testdata", "sysfs"),
+	})
+}
+
+// golden renders the skipped containers of the first recording and every
+// collection of the replay in a stable text form
+func golden(t *testing.T, dir string) []byte {
+	files, err := recordings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	skipped, err := newReplaySource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := skipped.Start(); err != nil {
+		t.Fatal(err)
+	}
+	containers, _ := skipped.GetContainerInfoV2("/", info.RequestOptions{})
+	names := []string{}
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if reason := skipReason(containers[name].Spec.Labels); reason != "" {
+			fmt.Fprintf(out, "skipped %s: %s\n", name, reason)
+		}
+	}
+
+	c := NewCollector()
+	config := newSnapshot(replayMetrics(dir))
+	if err := c.ensureSource(config); err != nil {
+		t.Fatal(err)
+	}
+	for i := range files {
+		fmt.Fprintf(out, "# collection %d\n", i+1)
+		lines := []string{}
+		for _, m := range c.collect(config) {
+			lines = append(lines, fmt.Sprintf("%s %v %s %s", m.Namespace.String(), m.Data, m.Unit, m.Timestamp.UTC().Format(time.RFC3339)))
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(out, line)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestReplayGolden(t *testing.T) {
+	for _, scenario := range []string{"kubernetes", "docker", "multi_interface"} {
+		actual := golden(t, filepath.Join("testdata", "replay", scenario))
+		file := filepath.Join("testdata", "golden", scenario+".golden")
+		if *update {
+			if err := ioutil.WriteFile(file, actual, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("%s: replay differs from %s, run go test -update to accept:\n%s", scenario, file, actual)
+		}
+	}
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder := newRecordingSource(&fakeSource{stats: statsAt(10)}, dir)
+	if err := recorder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	recorded := []map[string]info.ContainerInfo{}
+	for i := 0; i < 2; i++ {
+		containers, err := recorder.GetContainerInfoV2("/", info.RequestOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, containers)
+	}
+
+	replay, err := newReplaySource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// the last recording is served again once the replay is exhausted
+	for _, expected := range append(recorded, recorded[1]) {
+		containers, err := replay.GetContainerInfoV2("/", info.RequestOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(containers) != 1 || !reflect.DeepEqual(containers["/kubepods/pod1/cont1"].Spec.Labels, expected["/kubepods/pod1/cont1"].Spec.Labels) {
+			t.Errorf("unexpected replayed containers %v", containers)
+		}
+		stats := containers["/kubepods/pod1/cont1"].Stats
+		if len(stats) != 1 || !stats[0].Timestamp.Equal(time.Unix(10, 0)) || stats[0].Memory.Usage != testStats().Memory.Usage {
+			t.Errorf("replayed stats differ from the recorded ones: %v", stats)
+		}
+	}
+
+	// restarting the recorder continues the numbering
+	if err := recorder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.GetContainerInfoV2("/", info.RequestOptions{})
+	if files, _ := recordings(dir); len(files) != 3 || filepath.Base(files[2]) != "000003.json" {
+		t.Errorf("expected a third recording, got %v", files)
+	}
+}
+
+func TestRecordingSourceMachine(t *testing.T) {
+	machine := &machineFakeSource{machine: &v1.MachineInfo{MachineID: "abc"}}
+	if tags := machineTagsOf(newRecordingSource(machine, "")); tags["machine_id"] != "abc" {
+		t.Errorf("expected the machine of the recorded source, got %v", tags)
+	}
+	if tags := machineTagsOf(newRecordingSource(&fakeSource{}, "")); tags == nil || len(tags) != 0 {
+		t.Errorf("expected no machine_id from a recorded source without machine, got %v", tags)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	c := NewCollector()
+	if err := c.ensureSource(newSnapshot(replayMetrics(""))); err == nil {
+		t.Error("expected an error for a replay source without replay_dir")
+	}
+	empty, err := ioutil.TempDir("", "cadvisor-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	if err := c.ensureSource(newSnapshot(replayMetrics(empty))); err == nil {
+		t.Error("expected an error for a replay_dir without recordings")
+	}
+	if metrics := c.collect(c.current()); len(metrics) != 0 {
+		t.Errorf("expected no metrics without a source, got %v", metrics)
+	}
+	config := newSnapshot(replayMetrics(filepath.Join("testdata", "replay", "docker")))
+	if err := c.ensureSource(config); err != nil {
+		t.Errorf("expected the next config to start the source, got %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package cadvisor
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// Aggregation summarizes the values a metric took over an interval. Gauges are
+// summarized as sampled, counters as their per second rate between samples.
+type Aggregation struct {
+	Name        string
+	Description string
+	Apply       func(sorted []float64) float64
+}
+
+// percentile returns the nearest rank percentile p of sorted values
+func percentile(p float64) func(sorted []float64) float64 {
+	return func(sorted []float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return sorted[rank]
+	}
+}
+
+// aggregations holds every summary that can be requested for a metric
+var aggregations = []*Aggregation{
+	{Name: "min", Description: "minimum", Apply: func(sorted []float64) float64 { return sorted[0] }},
+	{Name: "max", Description: "maximum", Apply: func(sorted []float64) float64 { return sorted[len(sorted)-1] }},
+	{Name: "avg", Description: "average", Apply: func(sorted []float64) float64 {
+		sum := 0.0
+		for _, v := range sorted {
+			sum += v
+		}
+		return sum / float64(len(sorted))
+	}},
+	{Name: "p50", Description: "50th percentile", Apply: percentile(50)},
+	{Name: "p90", Description: "90th percentile", Apply: percentile(90)},
+	{Name: "p95", Description: "95th percentile", Apply: percentile(95)},
+	{Name: "p99", Description: "99th percentile", Apply: percentile(99)},
+}
+
+func lookupAggregation(name string) (*Aggregation, bool) {
+	for _, a := range aggregations {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// statRequest is a summary of a registry metric requested by the task
+type statRequest struct {
+	metric      *Metric
+	aggregation *Aggregation
+}
+
+// Namespace returns the namespace of the summary, which is the namespace of
+// the metric with the aggregation as additional leaf
+func (r statRequest) Namespace(ns string, pn string, cn string, device string) plugin.Namespace {
+	return r.metric.Namespace(ns, pn, cn, device).AddStaticElement(r.aggregation.Name)
+}
+
+// CompatName returns the name of the summary in the cadvisor scheme
+func (r statRequest) CompatName() string {
+	return strings.TrimSuffix(r.metric.Compat.Name, "_total") + "_" + r.aggregation.Name
+}
+
+// CatalogNamespace returns the namespace the summary is advertised with in scheme
+func (r statRequest) CatalogNamespace(scheme string) plugin.Namespace {
+	if scheme == schemeCadvisor {
+		return plugin.NewNamespace(r.CompatName())
+	}
+	return r.Namespace("*", "*", "*", "*")
+}
+
+// Unit is the unit of the summarized values in scheme
+func (r statRequest) Unit(scheme string) string {
+	unit := r.metric.Unit
+	if scheme == schemeCadvisor {
+		unit = r.metric.CompatUnit()
+	}
+	if r.metric.Kind == Counter {
+		return unit + "/s"
+	}
+	return unit
+}
+
+// Description describes the summary
+func (r statRequest) Description() string {
+	if r.metric.Kind == Counter {
+		return r.aggregation.Description + " per second rate over the interval of: " + r.metric.Description
+	}
+	return r.aggregation.Description + " over the interval of: " + r.metric.Description
+}
+
+// lookupStat finds the summary a requested namespace refers to
+func lookupStat(ns plugin.Namespace) (statRequest, bool) {
+	if len(ns) <= familyIndex+1 {
+		return statRequest{}, false
+	}
+	a, ok := lookupAggregation(ns.Element(len(ns) - 1).Value)
+	if !ok {
+		return statRequest{}, false
+	}
+	m, ok := lookupMetric(ns[:len(ns)-1])
+	if !ok {
+		return statRequest{}, false
+	}
+	return statRequest{metric: m, aggregation: a}, true
+}
+
+// lookupCompatStats finds the summaries sharing a cadvisor scheme namespace
+func lookupCompatStats(ns plugin.Namespace) []statRequest {
+	if len(ns) != 1 {
+		return nil
+	}
+	stats := []statRequest{}
+	for _, m := range registry {
+		for _, a := range aggregations {
+			if r := (statRequest{metric: m, aggregation: a}); r.CompatName() == ns.Element(0).Value {
+				stats = append(stats, r)
+			}
+		}
+	}
+	return stats
+}
+
+// parseStatsConfig reads the summaries enabled per family from a config value
+// of the form "mem:max,p95;cpu:p95;tcp:max"
+func parseStatsConfig(value string) map[string][]*Aggregation {
+	families := map[string][]*Aggregation{}
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			log.Printf("invalid stats entry %q, expected <family>:<aggregation>[,<aggregation>]\n", entry)
+			continue
+		}
+		family := strings.TrimSpace(parts[0])
+		for _, name := range strings.Split(parts[1], ",") {
+			a, ok := lookupAggregation(strings.TrimSpace(name))
+			if !ok {
+				log.Printf("unknown aggregation %q for family %s\n", name, family)
+				continue
+			}
+			families[family] = append(families[family], a)
+		}
+	}
+	return families
+}
+
+// statCatalog returns the summaries enabled by cfg named as in its schema
+// version, in registry order
+func statCatalog(cfg plugin.Config) []statRequest {
+	families := parseStatsConfig(getString(cfg, "stats", ""))
+	stats := []statRequest{}
+	for _, m := range registryFor(schemaOf(cfg)) {
+		for _, a := range families[m.Family] {
+			stats = append(stats, statRequest{metric: m, aggregation: a})
+		}
+	}
+	return stats
+}
+
+// point is a single value a metric took at a given time
+type point struct {
+	timestamp time.Time
+	value     float64
+}
+
+// series collects the values of a metric per device name from samples, oldest
+// first, along with the devices in the order they were found
+func series(m *Metric, samples []*info.ContainerStats, devices *containerDevices) (map[string][]point, []Device) {
+	values := map[string][]point{}
+	found := []Device{}
+	add := func(d Device, t time.Time, v interface{}) {
+		f, ok := toFloat(v)
+		if !ok {
+			return
+		}
+		if _, ok := values[d.Name]; !ok {
+			found = append(found, d)
+		}
+		values[d.Name] = append(values[d.Name], point{timestamp: t, value: f})
+	}
+	for i, s := range samples {
+		if !m.PerDevice() {
+			add(Device{}, s.Timestamp, m.Data(s))
+			continue
+		}
+		var prev *info.ContainerStats
+		if i > 0 {
+			prev = samples[i-1]
+		}
+		m.values(prev, s, func(d Device, v interface{}) {
+			if d = devices.resolve(m.Family, d); devices.collects(m.Family, d) {
+				add(d, s.Timestamp, v)
+			}
+		})
+	}
+	return values, found
+}
+
+// window returns the values of points within interval of the last point, counters
+// are turned into per second rates between consecutive points
+func window(points []point, kind Kind, interval time.Duration) []float64 {
+	if len(points) == 0 {
+		return nil
+	}
+	start := points[len(points)-1].timestamp.Add(-interval)
+	values := []float64{}
+	for i, p := range points {
+		if !p.timestamp.After(start) {
+			continue
+		}
+		if kind != Counter {
+			values = append(values, p.value)
+			continue
+		}
+		if i == 0 {
+			continue
+		}
+		elapsed := p.timestamp.Sub(points[i-1].timestamp).Seconds()
+		if elapsed <= 0 || p.value < points[i-1].value {
+			continue
+		}
+		values = append(values, (p.value-points[i-1].value)/elapsed)
+	}
+	return values
+}
+
+// convertStats appends the summaries requested by stats over the samples of a
+// container within interval of its latest sample, for the devices emitted by
+// devices, named after the cached series of the container
+func convertStats(metrics []plugin.Metric, stats []statRequest, container *containerSeries, spec info.ContainerSpec, samples []*info.ContainerStats, interval time.Duration, devices *containerDevices) []plugin.Metric {
+	if len(samples) == 0 {
+		return metrics
+	}
+	sorted := make([]*info.ContainerStats, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+	latest := sorted[len(sorted)-1].Timestamp
+
+	cache := map[*Metric]map[string][]point{}
+	order := map[*Metric][]Device{}
+	for _, r := range stats {
+		if !r.metric.Requires.supported(spec) {
+			continue
+		}
+		if _, ok := cache[r.metric]; !ok {
+			cache[r.metric], order[r.metric] = series(r.metric, sorted, devices)
+		}
+		for _, device := range order[r.metric] {
+			if r.metric.PerDevice() && devices.drops(r.metric.Family, device.Name, r.metric.id()+"/"+r.aggregation.Name) {
+				continue
+			}
+			values := window(cache[r.metric][device.Name], r.metric.Kind, interval)
+			if len(values) == 0 {
+				continue
+			}
+			sort.Float64s(values)
+			var data interface{} = r.aggregation.Apply(values)
+			if container.scheme == schemeCadvisor {
+				data = r.metric.compatData(data)
+			}
+			name := container.summary(r, device)
+			metrics = append(metrics, plugin.Metric{
+				Namespace:   name.namespace,
+				Description: r.Description(),
+				Unit:        r.Unit(container.scheme),
+				Data:        data,
+				Tags:        name.tags,
+				Timestamp:   latest,
+			})
+		}
+	}
+	return metrics
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,168 @@
+package cadvisor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+func TestAggregations(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	expected := map[string]float64{"min": 1, "max": 20, "avg": 10.5, "p50": 10, "p90": 18, "p95": 19, "p99": 20}
+	for name, want := range expected {
+		a, ok := lookupAggregation(name)
+		if !ok {
+			t.Fatalf("aggregation %s does not exist", name)
+		}
+		if got := a.Apply(sorted); got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestParseStatsConfig(t *testing.T) {
+	families := parseStatsConfig(" mem:max,p95 ; cpu:p95;tcp:bogus;broken")
+	if len(families["mem"]) != 2 || families["mem"][0].Name != "max" || families["mem"][1].Name != "p95" {
+		t.Errorf("unexpected mem aggregations %v", families["mem"])
+	}
+	if len(families["cpu"]) != 1 || families["cpu"][0].Name != "p95" {
+		t.Errorf("unexpected cpu aggregations %v", families["cpu"])
+	}
+	if len(families["tcp"]) != 0 || len(families) != 2 {
+		t.Errorf("invalid entries were not ignored: %v", families)
+	}
+}
+
+func TestStatCatalogAndLookup(t *testing.T) {
+	stats := statCatalog(plugin.Config{"stats": "mem:max"})
+	mem := 0
+	for _, m := range registry {
+		if m.Family == "mem" {
+			mem++
+		}
+	}
+	if len(stats) != mem {
+		t.Fatalf("expected %d mem summaries, got %d", mem, len(stats))
+	}
+	for _, r := range stats {
+		found, ok := lookupStat(r.Namespace("*", "*", "*", "*"))
+		if !ok || found != r {
+			t.Errorf("%s does not resolve to its summary", r.Namespace("*", "*", "*", "*").String())
+		}
+	}
+	if _, ok := lookupStat(plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage")); ok {
+		t.Error("plain metric resolved to a summary")
+	}
+}
+
+func TestConvertStats(t *testing.T) {
+	samples := statsAt(0, 10, 20, 30)
+	for i, s := range samples {
+		// cpu usage grows by 10s of cpu time every 10s and then doubles
+		s.Cpu.Usage.Total = uint64(i*i) * uint64(10*time.Second)
+		s.Memory.WorkingSet = uint64(100 * (i + 1))
+		s.Network.Interfaces[0].RxBytes = uint64(i * 1000)
+	}
+	stat := func(ns string) statRequest {
+		r, ok := lookupStat(plugin.NewNamespace(append([]string{PluginVendor, PluginName, "container", "*", "*", "*"}, strings.Split(ns, "/")...)...))
+		if !ok {
+			t.Fatalf("summary %s does not exist", ns)
+		}
+		return r
+	}
+	requested := []statRequest{stat("mem/working_set/max"), stat("cpu/total/usage/max"), stat("iface/*/in_bytes/avg")}
+	spec := (&fakeSource{}).spec()
+	metrics := convertStats(nil, requested, newContainerSeries([3]string{"ns", "pod", "cont"}, schemeSnap), spec, samples, 20*time.Second, nil)
+
+	prefix := containerNamespace("ns", "pod", "cont").String() + "/"
+	expected := map[string]float64{
+		// only the samples at 20s and 30s are within the interval
+		"mem/working_set/max": 400,
+		// rates are 1s/s, 3s/s and 5s/s, the last two are within the interval
+		"cpu/total/usage/max":     float64(5 * time.Second),
+		"iface/eth0/in_bytes/avg": 100,
+	}
+	if len(metrics) != len(expected) {
+		t.Fatalf("expected %d summaries, got %d", len(expected), len(metrics))
+	}
+	for _, m := range metrics {
+		name := m.Namespace.String()[len(prefix):]
+		if m.Data != expected[name] {
+			t.Errorf("%s: expected %v, got %v", name, expected[name], m.Data)
+		}
+		if m.Timestamp.Unix() != 30 {
+			t.Errorf("%s: expected the timestamp of the latest sample, got %v", name, m.Timestamp)
+		}
+	}
+}
+
+func TestConvertStatsDeviceTags(t *testing.T) {
+	requested, ok := lookupStat(plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "read_bytes", "max"))
+	if !ok {
+		t.Fatal("summary diskio/*/read_bytes/max does not exist")
+	}
+	contInfo := [3]string{"ns", "pod", "cont"}
+	for _, scheme := range []string{schemeSnap, schemeCadvisor} {
+		metrics := convertStats(nil, []statRequest{requested}, newContainerSeries(contInfo, scheme), (&fakeSource{}).spec(), statsAt(10, 20), 20*time.Second, nil)
+		if len(metrics) != 1 {
+			t.Fatalf("%s: expected the summary of sda, got %d metrics", scheme, len(metrics))
+		}
+		// summaries are tagged like the series they summarize
+		series := newContainerSeries(contInfo, scheme).name(requested.metric, Device{Name: "sda", Major: 8})
+		if tags := metrics[0].Tags; !reflect.DeepEqual(tags, series.tags) || tags["major"] != "8" {
+			t.Errorf("%s: expected tags %v, got %v", scheme, series.tags, tags)
+		}
+	}
+}
+
+func TestSummaryHistory(t *testing.T) {
+	summary := plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "working_set", "max")
+	plain := plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "working_set")
+	for _, tc := range []struct {
+		interval int64
+		ns       plugin.Namespace
+		highRes  bool
+		expected time.Duration
+	}{
+		{interval: 15, ns: summary, expected: storageDuration},
+		{interval: 300, ns: plain, expected: storageDuration},
+		{interval: 300, ns: summary, expected: 5 * time.Minute},
+		{interval: 300, ns: plain, highRes: true, expected: 5 * time.Minute},
+	} {
+		requested := requestedMetrics(tc.interval, tc.ns)
+		requested[0].Config["high_resolution"] = tc.highRes
+		if history := newSnapshot(requested).history(); history != tc.expected {
+			t.Errorf("%s every %ds: expected %v of history, got %v", tc.ns.String(), tc.interval, tc.expected, history)
+		}
+	}
+
+	// a later task cannot grow the history of the running source
+	c := NewCollector()
+	c.mng = &fakeSource{}
+	c.history = storageDuration
+	if err := c.checkHistory(newSnapshot(requestedMetrics(15, summary))); err != nil {
+		t.Errorf("expected the history to cover a short interval, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mtxIn := make(chan []plugin.Metric)
+	mtxOut := make(chan []plugin.Metric)
+	chanErr := make(chan string, 1)
+	go c.StreamMetrics(ctx, mtxIn, mtxOut, chanErr)
+
+	<-mtxOut
+	mtxIn <- requestedMetrics(300, summary)
+	select {
+	case err := <-chanErr:
+		if !strings.Contains(err, "1m0s of samples") {
+			t.Errorf("unexpected error %q", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error sent for summaries longer than the history")
+	}
+	<-mtxOut
+}
@@ -0,0 +1,172 @@
+package cadvisor
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/cadvisor/info/v1"
+	info "github.com/google/cadvisor/info/v2"
+)
+
+// syntheticStep is the time between two samples of the synthetic source
+const syntheticStep = 10 * time.Second
+
+// syntheticHistory is the number of samples the synthetic source keeps per
+// container, like the one minute of history cAdvisor keeps at its default
+// housekeeping interval
+const syntheticHistory = 6
+
+// syntheticShape sizes the node generated by the synthetic source
+type syntheticShape struct {
+	containers int
+	interfaces int
+	disks      int
+}
+
+// syntheticContainer holds the rates a synthetic container grows its
+// counters by on every sample
+type syntheticContainer struct {
+	name   string
+	spec   info.ContainerSpec
+	cpu    uint64
+	memory uint64
+	net    uint64
+	disk   uint64
+}
+
+// syntheticSource generates kubernetes containers with the given number of
+// interfaces and disks. Every call advances a virtual clock by syntheticStep so
+// counters keep growing and every collection sees a fresh sample, the values
+// only depend on the shape and the number of calls.
+type syntheticSource struct {
+	shape      syntheticShape
+	start      time.Time
+	containers []syntheticContainer
+	lock       sync.Mutex
+	tick       int
+}
+
+func newSyntheticSource(shape syntheticShape) (*syntheticSource, error) {
+	if shape.containers < 1 || shape.interfaces < 0 || shape.disks < 0 {
+		return nil, fmt.Errorf("invalid synthetic node of %d containers, %d interfaces and %d disks", shape.containers, shape.interfaces, shape.disks)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	containers := make([]syntheticContainer, shape.containers)
+	for i := range containers {
+		pod := fmt.Sprintf("pod-%d", i/2)
+		containers[i] = syntheticContainer{
+			name: fmt.Sprintf("/kubepods/burstable/%s/container-%d", pod, i),
+			spec: info.ContainerSpec{
+				Labels: map[string]string{
+					KubernetesPodNamespaceLabel:  fmt.Sprintf("namespace-%d", i/2%10),
+					KubernetesPodNameLabel:       pod,
+					KubernetesContainerNameLabel: fmt.Sprintf("container-%d", i%2),
+				},
+				HasCpu:        true,
+				HasMemory:     true,
+				HasNetwork:    shape.interfaces > 0,
+				HasFilesystem: true,
+				HasDiskIo:     shape.disks > 0,
+			},
+			cpu:    uint64(rnd.Int63n(1e9)),
+			memory: uint64(rnd.Int63n(1 << 30)),
+			net:    uint64(rnd.Int63n(1 << 20)),
+			disk:   uint64(rnd.Int63n(1 << 20)),
+		}
+	}
+	return &syntheticSource{shape: shape, start: time.Unix(1500000000, 0), containers: containers}, nil
+}
+
+// Start is a no-op, the synthetic node exists from the start
+func (s *syntheticSource) Start() error {
+	return nil
+}
+
+// GetContainerInfoV2 returns the next sample of every container, with up to
+// options.Count samples of history
+func (s *syntheticSource) GetContainerInfoV2(containerName string, options info.RequestOptions) (map[string]info.ContainerInfo, error) {
+	s.lock.Lock()
+	s.tick++
+	tick := s.tick
+	s.lock.Unlock()
+
+	count := options.Count
+	if count < 0 || count > syntheticHistory {
+		count = syntheticHistory
+	}
+	if count > tick {
+		count = tick
+	}
+	containers := make(map[string]info.ContainerInfo, len(s.containers))
+	for _, cont := range s.containers {
+		stats := make([]*info.ContainerStats, 0, count)
+		for t := tick - count + 1; t <= tick; t++ {
+			stats = append(stats, s.sample(cont, t))
+		}
+		containers[cont.name] = info.ContainerInfo{Spec: cont.spec, Stats: stats}
+	}
+	return containers, nil
+}
+
+// sample generates the stats of cont at tick t
+func (s *syntheticSource) sample(cont syntheticContainer, t int) *info.ContainerStats {
+	n := uint64(t)
+	// gauges wander around their base value, counters grow by their rate
+	wave := uint64(t%7) * cont.memory / 20
+	stats := &info.ContainerStats{
+		Timestamp: s.start.Add(time.Duration(t) * syntheticStep),
+		Cpu: &v1.CpuStats{
+			Usage:       v1.CpuUsage{Total: n * cont.cpu, User: n * cont.cpu * 3 / 4, System: n * cont.cpu / 4},
+			LoadAverage: int32(t % 3),
+		},
+		Memory: &v1.MemoryStats{
+			Usage:      cont.memory + wave,
+			Cache:      cont.memory / 4,
+			RSS:        cont.memory/2 + wave,
+			WorkingSet: cont.memory*3/4 + wave,
+			Failcnt:    n / 100,
+		},
+		Network: &info.NetworkStats{
+			Tcp:  info.TcpStat{Established: uint64(t % 50), Listen: 2, TimeWait: uint64(t % 11)},
+			Tcp6: info.TcpStat{Established: uint64(t % 5), Listen: 1},
+		},
+	}
+	total, base, inodes := cont.memory/2+n*4096, uint64(4096), 100+n
+	stats.Filesystem = &info.FilesystemStats{TotalUsageBytes: &total, BaseUsageBytes: &base, InodeUsage: &inodes}
+
+	for i := 0; i < s.shape.interfaces; i++ {
+		rate := cont.net / uint64(i+1)
+		stats.Network.Interfaces = append(stats.Network.Interfaces, v1.InterfaceStats{
+			Name:      fmt.Sprintf("eth%d", i),
+			RxBytes:   n * rate,
+			RxPackets: n * rate / 1000,
+			RxDropped: n / 50,
+			TxBytes:   n * rate / 2,
+			TxPackets: n * rate / 2000,
+			TxErrors:  n / 200,
+		})
+	}
+	if s.shape.disks > 0 {
+		stats.DiskIo = &v1.DiskIoStats{}
+		for i := 0; i < s.shape.disks; i++ {
+			rate := cont.disk / uint64(i+1)
+			disk := func(read, write uint64) v1.PerDiskStats {
+				return v1.PerDiskStats{
+					Device: fmt.Sprintf("sd%c", 'a'+i%26),
+					Major:  8,
+					Minor:  uint64(16 * i),
+					Stats:  map[string]uint64{"Read": read, "Write": write, "Total": read + write},
+				}
+			}
+			stats.DiskIo.IoServiceBytes = append(stats.DiskIo.IoServiceBytes, disk(n*rate, n*rate*2))
+			stats.DiskIo.IoServiced = append(stats.DiskIo.IoServiced, disk(n*rate/4096, n*rate/2048))
+			stats.DiskIo.IoQueued = append(stats.DiskIo.IoQueued, disk(uint64(t%3), uint64(t%4)))
+			stats.DiskIo.Sectors = append(stats.DiskIo.Sectors, disk(n*rate/512, n*rate/256))
+			stats.DiskIo.IoMerged = append(stats.DiskIo.IoMerged, disk(n*rate/8192, n*rate/4096))
+			stats.DiskIo.IoServiceTime = append(stats.DiskIo.IoServiceTime, disk(n*rate/10, n*rate/5))
+		}
+	}
+	return stats
+}
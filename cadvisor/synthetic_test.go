@@ -0,0 +1,170 @@
+package cadvisor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v2"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// syntheticMetrics requests every registry metric from a synthetic node of shape
+func syntheticMetrics(shape syntheticShape) []plugin.Metric {
+	return requestAll(plugin.Config{
+		"interval":             int64(15),
+		"source":               sourceSynthetic,
+		"synthetic_containers": int64(shape.containers),
+		"synthetic_interfaces": int64(shape.interfaces),
+		"synthetic_disks":      int64(shape.disks),
+	})
+}
+
+// syntheticSeries is the number of series a synthetic node of shape emits
+// once metrics can be derived from a previous collection
+func syntheticSeries(shape syntheticShape) int {
+	series := 0
+	for _, m := range registry {
+		switch {
+		case m.Family == "iface":
+			series += shape.interfaces
+		case m.Family == "diskio":
+			series += shape.disks
+		default:
+			series++
+		}
+	}
+	return series * shape.containers
+}
+
+func TestSyntheticSource(t *testing.T) {
+	shape := syntheticShape{containers: 4, interfaces: 3, disks: 2}
+	source, err := newSyntheticSource(shape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := source.GetContainerInfoV2("/", info.RequestOptions{Count: 1})
+	second, _ := source.GetContainerInfoV2("/", info.RequestOptions{Count: -1})
+	if len(first) != shape.containers || len(second) != shape.containers {
+		t.Fatalf("expected %d containers, got %d and %d", shape.containers, len(first), len(second))
+	}
+	for name, cont := range second {
+		if _, ok := checkContainer(cont.Spec.Labels); !ok {
+			t.Errorf("%s is not a kubernetes container", name)
+		}
+		if len(cont.Stats) != 2 || len(first[name].Stats) != 1 {
+			t.Fatalf("%s: expected the history of every call, got %d samples", name, len(cont.Stats))
+		}
+		prev, next := first[name].Stats[0], cont.Stats[1]
+		if !next.Timestamp.Equal(prev.Timestamp.Add(syntheticStep)) {
+			t.Errorf("%s: expected samples %v apart, got %v and %v", name, syntheticStep, prev.Timestamp, next.Timestamp)
+		}
+		if next.Cpu.Usage.Total <= prev.Cpu.Usage.Total || next.Network.Interfaces[0].RxBytes <= prev.Network.Interfaces[0].RxBytes {
+			t.Errorf("%s: expected counters to grow", name)
+		}
+		if len(next.Network.Interfaces) != shape.interfaces || len(next.DiskIo.IoServiceBytes) != shape.disks {
+			t.Errorf("%s: expected %d interfaces and %d disks", name, shape.interfaces, shape.disks)
+		}
+	}
+
+	c := NewCollector()
+	config := newSnapshot(syntheticMetrics(shape))
+	if err := c.ensureSource(config); err != nil {
+		t.Fatal(err)
+	}
+	derived := 0
+	for _, m := range registry {
+		if m.Derive != nil {
+			derived += shape.disks * shape.containers
+		}
+	}
+	if metrics := c.collect(config); len(metrics) != syntheticSeries(shape)-derived {
+		t.Errorf("expected %d series without a previous collection, got %d", syntheticSeries(shape)-derived, len(metrics))
+	}
+	if metrics := c.collect(config); len(metrics) != syntheticSeries(shape) {
+		t.Errorf("expected %d series, got %d", syntheticSeries(shape), len(metrics))
+	}
+	if _, err := newSyntheticSource(syntheticShape{}); err == nil {
+		t.Error("expected an error for a node without containers")
+	}
+}
+
+// BenchmarkCollect measures the collect, convert and tagging path of a stream
+// emission on synthetic nodes, named after their shape and the series every
+// collection emits
+func BenchmarkCollect(b *testing.B) {
+	for _, shape := range []syntheticShape{
+		{containers: 10, interfaces: 1, disks: 1},
+		{containers: 100, interfaces: 2, disks: 2},
+		{containers: 500, interfaces: 30, disks: 2},
+	} {
+		expected := syntheticSeries(shape)
+		name := fmt.Sprintf("containers=%d/interfaces=%d/disks=%d/series=%d", shape.containers, shape.interfaces, shape.disks, expected)
+		b.Run(name, func(b *testing.B) {
+			c := NewCollector()
+			config := newSnapshot(syntheticMetrics(shape))
+			if err := c.ensureSource(config); err != nil {
+				b.Fatal(err)
+			}
+			// the first collection has nothing to derive disk metrics from
+			c.collect(config)
+			series := 0
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				series = len(c.withSelf(config, c.collect(config), time.Now()))
+			}
+			b.StopTimer()
+			if series != expected {
+				b.Errorf("expected %d series, got %d", expected, series)
+			}
+		})
+	}
+}
+
+// BenchmarkEmission measures a whole stream emission, which additionally
+// converts the self metrics and merges every metric into the Prometheus
+// exporter when it listens
+func BenchmarkEmission(b *testing.B) {
+	shape := syntheticShape{containers: 100, interfaces: 2, disks: 2}
+	requested := syntheticMetrics(shape)
+	for _, m := range selfRegistry {
+		requested = append(requested, plugin.Metric{Namespace: m.Namespace(), Config: requested[0].Config})
+	}
+	for _, listen := range []string{"", "localhost:0"} {
+		c := NewCollector()
+		config := newSnapshot(requested)
+		config.prometheusListen = listen
+		if err := c.ensureSource(config); err != nil {
+			b.Fatal(err)
+		}
+		// the first emission has nothing to derive disk metrics from
+		c.emission(context.Background(), config)
+		series := len(c.emission(context.Background(), config))
+		b.Run(fmt.Sprintf("series=%d/prometheus=%v", series, listen != ""), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.emission(context.Background(), config)
+			}
+		})
+	}
+}
+
+// BenchmarkCollectHighResolution additionally converts every sample of the
+// history, as done with high_resolution and stats
+func BenchmarkCollectHighResolution(b *testing.B) {
+	shape := syntheticShape{containers: 100, interfaces: 2, disks: 2}
+	c := NewCollector()
+	config := newSnapshot(syntheticMetrics(shape))
+	config.highRes = true
+	if err := c.ensureSource(config); err != nil {
+		b.Fatal(err)
+	}
+	c.collect(config)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.collect(config)
+	}
+}
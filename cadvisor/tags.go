@@ -0,0 +1,182 @@
+package cadvisor
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/cadvisor/info/v1"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// machineSource is implemented by container sources that know the machine
+// they run on, like cAdvisor's manager.Manager
+type machineSource interface {
+	GetMachineInfo() (*v1.MachineInfo, error)
+}
+
+// parseTags parses entries of "<tag>=<value>;<tag>=<value>", value passes
+// every value through and reports the ones to leave out
+func parseTags(entries string, value func(tag, v string) (string, bool)) map[string]string {
+	tags := map[string]string{}
+	for _, entry := range strings.Split(entries, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			log.Printf("invalid tag %q, expected <tag>=<value>\n", entry)
+			continue
+		}
+		tag := strings.TrimSpace(parts[0])
+		if v, ok := value(tag, strings.TrimSpace(parts[1])); ok {
+			tags[tag] = v
+		}
+	}
+	return tags
+}
+
+// tagsOf returns the global tags set in cfg: the static "tags" and the
+// "env_tags" read from the environment of the plugin, which take precedence.
+// Environment variables that are not set are left out.
+func tagsOf(cfg plugin.Config) map[string]string {
+	tags := parseTags(getString(cfg, "tags", ""), func(tag, v string) (string, bool) {
+		return v, true
+	})
+	env := parseTags(getString(cfg, "env_tags", ""), func(tag, name string) (string, bool) {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			log.Printf("environment variable %s of tag %s is not set, leaving the tag out\n", name, tag)
+		}
+		return v, ok && v != ""
+	})
+	for tag, v := range env {
+		tags[tag] = v
+	}
+	return tags
+}
+
+// nodeNameEnv is the environment variable holding the name of the node the
+// plugin runs on, a DaemonSet sets it from spec.nodeName through the downward
+// API since the hostname of its pods is the name of the pod
+const nodeNameEnv = "NODE_NAME"
+
+// globalTags holds the tags added to every emitted metric. The machine tags
+// are looked up once from the container source, the tags of the last config
+// are kept so they are only merged again when the config changes.
+type globalTags struct {
+	lock sync.Mutex
+	// machine holds the machine_id tag, nil until the machine was found
+	machine map[string]string
+	config  *snapshot
+	tags    map[string]string
+}
+
+// of returns the global tags of config, source is the started container source
+func (g *globalTags) of(config *snapshot, source containerSource) map[string]string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !config.hostTags {
+		return config.tags
+	}
+	if g.config == config && g.machine != nil {
+		return g.tags
+	}
+	if g.machine == nil {
+		g.machine = machineTagsOf(source)
+	}
+	tags := map[string]string{}
+	if host := hostName(); host != "" {
+		tags["host"] = host
+	}
+	for tag, v := range g.machine {
+		tags[tag] = v
+	}
+	for tag, v := range config.tags {
+		tags[tag] = v
+	}
+	g.config, g.tags = config, tags
+	return tags
+}
+
+// hostName returns the name of the node in nodeNameEnv, or the hostname of
+// the plugin when it is not set
+func hostName() string {
+	if node := os.Getenv(nodeNameEnv); node != "" {
+		return node
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("unable to get the hostname: %v\n", err)
+		return ""
+	}
+	return hostname
+}
+
+// machineTagsOf returns the machine_id tag of the machine source, which
+// sources that do not know their machine have none of. It returns nil
+// while it cannot be found so it is looked up again.
+func machineTagsOf(source containerSource) map[string]string {
+	if source == nil {
+		return nil
+	}
+	tags := map[string]string{}
+	machines, ok := source.(machineSource)
+	if !ok {
+		return tags
+	}
+	machine, err := machines.GetMachineInfo()
+	if err != nil {
+		log.Printf("unable to get the machine info: %v\n", err)
+		return nil
+	}
+	if machine.MachineID != "" {
+		tags["machine_id"] = machine.MachineID
+	} else if machine.SystemUUID != "" {
+		tags["machine_id"] = machine.SystemUUID
+	}
+	return tags
+}
+
+// withTags adds tags to metrics, the tags of a metric take precedence.
+// Metrics without tags of their own share tags, which must not be modified.
+func withTags(metrics []plugin.Metric, tags map[string]string) []plugin.Metric {
+	for i := range metrics {
+		metrics[i].Tags = mergeTags(tags, metrics[i].Tags)
+	}
+	return metrics
+}
+
+// mergeTags returns the global tags with own added, which take precedence.
+// Either map is returned as is when the other one is empty.
+func mergeTags(global, own map[string]string) map[string]string {
+	if len(global) == 0 {
+		return own
+	}
+	if len(own) == 0 {
+		return global
+	}
+	merged := make(map[string]string, len(global)+len(own))
+	for tag, v := range global {
+		merged[tag] = v
+	}
+	for tag, v := range own {
+		merged[tag] = v
+	}
+	return merged
+}
+
+// sameTags reports whether a and b hold the same tags
+func sameTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for tag, v := range a {
+		if w, ok := b[tag]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
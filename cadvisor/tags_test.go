@@ -0,0 +1,134 @@
+package cadvisor
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/google/cadvisor/info/v1"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// machineFakeSource is a fakeSource that knows its machine
+type machineFakeSource struct {
+	fakeSource
+	machine *v1.MachineInfo
+	err     error
+}
+
+func (m *machineFakeSource) GetMachineInfo() (*v1.MachineInfo, error) {
+	return m.machine, m.err
+}
+
+func TestTagsOf(t *testing.T) {
+	os.Setenv("CADVISOR_TEST_NODE", "node1")
+	defer os.Unsetenv("CADVISOR_TEST_NODE")
+	tags := tagsOf(plugin.Config{
+		"tags":     "cluster=prod; region = eu ;invalid;=empty;node=static",
+		"env_tags": "node=CADVISOR_TEST_NODE;zone=CADVISOR_TEST_UNSET",
+	})
+	expected := map[string]string{"cluster": "prod", "region": "eu", "node": "node1"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+}
+
+func TestWithTags(t *testing.T) {
+	series := map[string]string{"container": "cont", "device": "eth0"}
+	metrics := withTags([]plugin.Metric{{}, {Tags: series}}, map[string]string{"cluster": "prod", "container": "global"})
+	if !reflect.DeepEqual(metrics[0].Tags, map[string]string{"cluster": "prod", "container": "global"}) {
+		t.Errorf("expected the global tags, got %v", metrics[0].Tags)
+	}
+	if !reflect.DeepEqual(metrics[1].Tags, map[string]string{"cluster": "prod", "container": "cont", "device": "eth0"}) {
+		t.Errorf("expected the series tags to take precedence, got %v", metrics[1].Tags)
+	}
+	if len(series) != 2 {
+		t.Errorf("series tags were modified: %v", series)
+	}
+	// metrics without tags of their own share the global tags
+	global := map[string]string{"cluster": "prod"}
+	metrics = withTags([]plugin.Metric{{}, {}}, global)
+	if reflect.ValueOf(metrics[0].Tags).Pointer() != reflect.ValueOf(global).Pointer() || reflect.ValueOf(metrics[1].Tags).Pointer() != reflect.ValueOf(global).Pointer() {
+		t.Errorf("expected the global tags to be shared, got %v and %v", metrics[0].Tags, metrics[1].Tags)
+	}
+	if metrics = withTags([]plugin.Metric{{Tags: series}}, map[string]string{}); reflect.ValueOf(metrics[0].Tags).Pointer() != reflect.ValueOf(series).Pointer() {
+		t.Errorf("expected the series tags to be kept without global tags, got %v", metrics[0].Tags)
+	}
+}
+
+func TestGlobalTags(t *testing.T) {
+	os.Unsetenv(nodeNameEnv)
+	hostname, _ := os.Hostname()
+	source := &machineFakeSource{err: errors.New("not ready")}
+	config := newSnapshot(requestedMetrics(15))
+	config.tags = map[string]string{"cluster": "prod"}
+	g := &globalTags{}
+	if tags := g.of(config, source); !reflect.DeepEqual(tags, map[string]string{"cluster": "prod", "host": hostname}) {
+		t.Errorf("expected the config and host tags until the machine is known, got %v", tags)
+	}
+	source.machine, source.err = &v1.MachineInfo{MachineID: "abc", SystemUUID: "uuid"}, nil
+	expected := map[string]string{"cluster": "prod", "host": hostname, "machine_id": "abc"}
+	if tags := g.of(config, source); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+	// the machine is only looked up once
+	source.machine = &v1.MachineInfo{MachineID: "changed"}
+	if tags := g.of(newSnapshot(requestedMetrics(15)), source); tags["machine_id"] != "abc" || tags["cluster"] != "" {
+		t.Errorf("expected the host tags of the first lookup without the previous config tags, got %v", tags)
+	}
+
+	config = newSnapshot([]plugin.Metric{{Config: plugin.Config{"host_tags": false, "tags": "cluster=prod"}}})
+	if tags := (&globalTags{}).of(config, source); !reflect.DeepEqual(tags, map[string]string{"cluster": "prod"}) {
+		t.Errorf("expected no host tags when disabled, got %v", tags)
+	}
+	if tags := (&globalTags{}).of(newSnapshot(requestedMetrics(15)), &fakeSource{}); !reflect.DeepEqual(tags, map[string]string{"host": hostname}) {
+		t.Errorf("expected the host tag without machine_id from a source without machine, got %v", tags)
+	}
+
+	// in a DaemonSet the node name is preferred over the name of the pod
+	os.Setenv(nodeNameEnv, "node1")
+	defer os.Unsetenv(nodeNameEnv)
+	if tags := (&globalTags{}).of(newSnapshot(requestedMetrics(15)), &fakeSource{}); tags["host"] != "node1" {
+		t.Errorf("expected the node name as host tag, got %v", tags)
+	}
+}
+
+func TestCollectMetricsTags(t *testing.T) {
+	c := NewCollector()
+	c.mng = &machineFakeSource{machine: &v1.MachineInfo{MachineID: "abc"}}
+	requested := requestedMetrics(15,
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "mem", "usage"),
+		plugin.NewNamespace(PluginVendor, PluginName, "container", "*", "*", "*", "diskio", "*", "reads"),
+		plugin.NewNamespace(PluginVendor, PluginName, "plugin", "collector", "timeouts"),
+	)
+	for _, m := range requested {
+		m.Config["tags"] = "cluster=prod"
+	}
+	metrics, err := c.CollectMetrics(requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("expected 3 metrics, got %v", metrics)
+	}
+	for _, m := range metrics {
+		if m.Tags["cluster"] != "prod" || m.Tags["machine_id"] != "abc" || m.Tags["host"] == "" {
+			t.Errorf("%s: expected the global tags, got %v", m.Namespace.String(), m.Tags)
+		}
+	}
+	// the tags are built once per series and shared by the next collections
+	c.mng.(*machineFakeSource).stats = statsAt(metrics[0].Timestamp.Unix() + 10)
+	again, err := c.CollectMetrics(requested)
+	if err != nil || len(again) != 3 {
+		t.Fatalf("expected 3 metrics, got %v %v", again, err)
+	}
+	for i := range again {
+		if again[i].Namespace.Element(2).Value != "container" {
+			continue
+		}
+		if reflect.ValueOf(again[i].Tags).Pointer() != reflect.ValueOf(metrics[i].Tags).Pointer() {
+			t.Errorf("%s: expected the cached tags to be reused", again[i].Namespace.String())
+		}
+	}
+}
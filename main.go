@@ -1,10 +1,33 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/grafana/snap-plugin-collector-cadvisor/cadvisor"
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 )
 
+// mode selects the Snap entry point, "stream" or "poll". Set it at build time
+// with -ldflags "-X main.mode=poll".
+var mode = "stream"
+
 func main() {
-	plugin.StartStreamCollector(cadvisor.NewCollector(), cadvisor.PluginName, cadvisor.PluginVersion, plugin.Exclusive(true))
+	// Snap starts plugins with a JSON argument, "debug" runs the collector standalone
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		if err := cadvisor.Debug(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	switch mode {
+	case "stream":
+		plugin.StartStreamCollector(cadvisor.NewCollector(), cadvisor.PluginName, cadvisor.PluginVersion, plugin.Exclusive(true))
+	case "poll":
+		plugin.StartCollector(cadvisor.NewCollector(), cadvisor.PluginName, cadvisor.PluginVersion, plugin.Exclusive(true))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown collector mode %q\n", mode)
+		os.Exit(1)
+	}
 }
@@ -12,10 +12,12 @@ __proj_dir="$(dirname "$__dir")"
 
 plugin_name=${__proj_dir##*/}
 build_dir="${__proj_dir}/build"
-go_build=(go build -ldflags "-w")
+collector_mode=${COLLECTOR_MODE:-stream}
+go_build=(go build -ldflags "-w -X main.mode=${collector_mode}")
 
 _info "project path: ${__proj_dir}"
 _info "plugin name: ${plugin_name}"
+_info "collector mode: ${collector_mode}"
 
 # rebuild binaries:
 _debug "removing: ${build_dir:?}/*"